@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/spf13/cobra"
+)
+
+// file names of the key caches in KEYS_CACHE_DIR
+const googleKeysCacheFile = "google-keys.json"
+const sessionCookieKeysCacheFile = "session-cookie-keys.json"
+
+func KeysCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Inspects the keys Firebase tokens are signed with",
+	}
+	cmd.AddCommand(keysListCmd(ctx))
+	return cmd
+}
+
+func keysListCmd(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Args:  cobra.ExactArgs(0),
+		Short: "Lists the kids of Google's ID token and session cookie keys and when they expire",
+		Long: "Lists the kids of Google's ID token and session cookie keys and when they expire.\n" +
+			"If KEYS_CACHE_DIR is set, keys cached there by the server are shown as long as they have not expired",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keySets := []struct {
+				name      string
+				cacheFile string
+				new       func(...jwt.KeyRetreiverOption) *jwt.GoogleKeyRetreiver
+			}{
+				{"id_token", googleKeysCacheFile, jwt.NewGoogleKeyRetreiver},
+				{"session_cookie", sessionCookieKeysCacheFile, jwt.NewSessionCookieKeyRetreiver},
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "KEY SET\tKID\tTYPE\tEXPIRES\tSOURCE")
+			for _, keySet := range keySets {
+				opts := []jwt.KeyRetreiverOption{}
+				if keysCacheDir := os.Getenv("KEYS_CACHE_DIR"); keysCacheDir != "" {
+					opts = append(opts, jwt.WithKeysCacheFile(filepath.Join(keysCacheDir, keySet.cacheFile)))
+				}
+				retreiver := keySet.new(opts...)
+				keys, err := retreiver.GetKeys(ctx)
+				if err != nil {
+					return fmt.Errorf("error getting %v keys: %w", keySet.name, err)
+				}
+				stats := retreiver.Stats()
+				source := "fetched"
+				if stats.RefreshSuccesses == 0 {
+					source = "cache file"
+				}
+				kids := make([]string, 0, len(keys))
+				for kid := range keys {
+					kids = append(kids, kid)
+				}
+				sort.Strings(kids)
+				for _, kid := range kids {
+					fmt.Fprintf(w, "%v\t%v\t%T\t%v (%v)\t%v\n", keySet.name, kid, keys[kid],
+						stats.ExpiresAt.UTC().Format(time.RFC3339), relativeTime(stats.ExpiresAt), source)
+				}
+			}
+			return w.Flush()
+		},
+	}
+}
+
+func printJSON(w io.Writer, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// relativeTime describes t relative to now, e.g. "in 2h0m0s" or "5m0s ago"
+func relativeTime(t time.Time) string {
+	d := time.Until(t).Round(time.Second)
+	if d < 0 {
+		return fmt.Sprintf("%v ago", -d)
+	}
+	return fmt.Sprintf("in %v", d)
+}
@@ -56,6 +56,8 @@ func Execute(ctx context.Context) int {
 	serverCmd := ServerCmd(ctx)
 
 	rootCmd.AddCommand(serverCmd)
+	rootCmd.AddCommand(TokenCmd(ctx))
+	rootCmd.AddCommand(KeysCmd(ctx))
 
 	go func() {
 		_ = http.ListenAndServe("localhost:6060", nil)
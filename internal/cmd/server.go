@@ -6,12 +6,17 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 
 	firebase "firebase.google.com/go/v4"
 	"github.com/bjarke-xyz/auth/internal/cmdutil"
 	serverPkg "github.com/bjarke-xyz/auth/internal/server"
 	"github.com/bjarke-xyz/auth/internal/service"
+	"github.com/bjarke-xyz/auth/pkg/authz"
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"google.golang.org/api/option"
@@ -28,11 +33,30 @@ func ServerCmd(ctx context.Context) *cobra.Command {
 				port, _ = strconv.Atoi(os.Getenv("PORT"))
 			}
 			logger := cmdutil.NewLogger("api")
+			shutdownTracing, err := cmdutil.SetupTracing(ctx, "api")
+			if err != nil {
+				return fmt.Errorf("error setting up tracing: %w", err)
+			}
+			defer shutdownTracing(context.WithoutCancel(ctx))
 
-			credentialsJson := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_CONTENT")
-			credentialsJsonBytes := []byte(credentialsJson)
-			opt := option.WithCredentialsJSON(credentialsJsonBytes)
-			app, err := firebase.NewApp(ctx, nil, opt)
+			projectID := os.Getenv("FIREBASE_PROJECT_ID")
+			// the admin SDK and the validator use the Firebase Auth emulator when this is set
+			emulatorHost := os.Getenv("FIREBASE_AUTH_EMULATOR_HOST")
+			if emulatorHost != "" && os.Getenv("ENV") == "prod" {
+				// emulator mode accepts unsigned tokens, so a leftover FIREBASE_AUTH_EMULATOR_HOST must not reach production
+				return fmt.Errorf("FIREBASE_AUTH_EMULATOR_HOST must not be set when ENV=prod")
+			}
+
+			var firebaseConfig *firebase.Config
+			opts := []option.ClientOption{}
+			if emulatorHost != "" {
+				// the emulator needs no credentials, but the project ID cannot be read from them
+				firebaseConfig = &firebase.Config{ProjectID: projectID}
+			}
+			if credentialsJson := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS_CONTENT"); credentialsJson != "" {
+				opts = append(opts, option.WithCredentialsJSON([]byte(credentialsJson)))
+			}
+			app, err := firebase.NewApp(ctx, firebaseConfig, opts...)
 			if err != nil {
 				return fmt.Errorf("error initializing app: %w", err)
 			}
@@ -45,9 +69,57 @@ func ServerCmd(ctx context.Context) *cobra.Command {
 				return fmt.Errorf("error unmarshaling ALLOWED_USERS environment variable")
 			}
 
-			authClient := service.NewFirebaseAuthRestClient(os.Getenv("FIREBASE_WEB_API_KEY"), os.Getenv("FIREBASE_PROJECT_ID"))
+			authClient := service.NewFirebaseAuthRestClient(os.Getenv("FIREBASE_WEB_API_KEY"), projectID)
+			if emulatorHost != "" {
+				authClient = service.NewFirebaseAuthEmulatorRestClient(emulatorHost, os.Getenv("FIREBASE_WEB_API_KEY"), projectID)
+			}
+
+			jwtMetrics, err := jwt.NewMetrics(prometheus.DefaultRegisterer)
+			if err != nil {
+				return fmt.Errorf("error registering jwt metrics: %w", err)
+			}
+			keyOpts := []jwt.KeyRetreiverOption{jwt.WithKeysMetrics(jwtMetrics, "id_token")}
+			sessionKeyOpts := []jwt.KeyRetreiverOption{jwt.WithKeysMetrics(jwtMetrics, "session_cookie")}
+			if keysCacheDir := os.Getenv("KEYS_CACHE_DIR"); keysCacheDir != "" {
+				keyOpts = append(keyOpts, jwt.WithKeysCacheFile(filepath.Join(keysCacheDir, googleKeysCacheFile)))
+				sessionKeyOpts = append(sessionKeyOpts, jwt.WithKeysCacheFile(filepath.Join(keysCacheDir, sessionCookieKeysCacheFile)))
+			}
+			keyRetreiver := jwt.NewGoogleKeyRetreiver(keyOpts...)
+			sessionKeyRetreiver := jwt.NewSessionCookieKeyRetreiver(sessionKeyOpts...)
+			if emulatorHost == "" {
+				go keyRetreiver.Start(ctx)
+				go sessionKeyRetreiver.Start(ctx)
+			}
+			firebaseAuth, err := app.Auth(ctx)
+			if err != nil {
+				return fmt.Errorf("error initializing auth client: %w", err)
+			}
+			revocationChecker := jwt.NewFirebaseRevocationChecker(firebaseAuth, time.Minute)
+			validatorOpts := []jwt.ValidatorOption{
+				jwt.WithKeyRetreiver(keyRetreiver),
+				jwt.WithSessionCookieKeyRetreiver(sessionKeyRetreiver),
+				jwt.WithRevocationChecker(revocationChecker),
+				jwt.WithMetrics(jwtMetrics),
+			}
+			if emulatorHost != "" {
+				logger.Warn("using Firebase Auth emulator, accepting unsigned tokens", "emulatorHost", emulatorHost)
+				validatorOpts = append(validatorOpts, jwt.WithEmulator())
+			}
+			validator := jwt.NewValidator(validatorOpts...)
+
+			adminRequirements := []authz.Requirement{}
+			if adminRole := os.Getenv("ADMIN_REQUIRED_ROLE"); adminRole != "" {
+				adminRequirements = append(adminRequirements, authz.HasRole(adminRole))
+			}
+			if adminPolicy := os.Getenv("ADMIN_POLICY"); adminPolicy != "" {
+				policy, err := authz.CEL(adminPolicy)
+				if err != nil {
+					return fmt.Errorf("error compiling ADMIN_POLICY: %w", err)
+				}
+				adminRequirements = append(adminRequirements, policy)
+			}
 
-			server, err := serverPkg.NewServer(ctx, logger, app, authClient, allowedUsers)
+			server, err := serverPkg.NewServer(ctx, logger, app, authClient, validator, allowedUsers, adminRequirements...)
 			if err != nil {
 				return fmt.Errorf("error initializing server: %w", err)
 			}
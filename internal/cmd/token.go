@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/cobra"
+)
+
+func TokenCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Inspects Firebase ID tokens and session cookies",
+	}
+	cmd.AddCommand(tokenDecodeCmd(), tokenVerifyCmd(ctx))
+	return cmd
+}
+
+func tokenDecodeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:          "decode <jwt>",
+		Args:         cobra.ExactArgs(1),
+		Short:        "Prints the header and claims of a token without verifying it",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			claims := gojwt.MapClaims{}
+			token, _, err := gojwt.NewParser().ParseUnverified(args[0], claims)
+			if err != nil {
+				return fmt.Errorf("error decoding token: %w", err)
+			}
+			out := cmd.OutOrStdout()
+			err = printJSON(out, map[string]any{"header": token.Header, "claims": claims})
+			if err != nil {
+				return err
+			}
+			for _, claim := range []string{"iat", "nbf", "auth_time", "exp"} {
+				if seconds, ok := claims[claim].(float64); ok {
+					t := time.Unix(int64(seconds), 0)
+					fmt.Fprintf(out, "%-9s %v (%v)\n", claim, t.UTC().Format(time.RFC3339), relativeTime(t))
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func tokenVerifyCmd(ctx context.Context) *cobra.Command {
+	audience := ""
+	sessionCookie := false
+	cmd := &cobra.Command{
+		Use:   "verify <jwt>",
+		Args:  cobra.ExactArgs(1),
+		Short: "Validates a token against Google's keys and prints its claims or why it was rejected",
+		Long: "Validates a token against Google's keys and prints its claims or why it was rejected. Revocation is not checked.\n" +
+			"If FIREBASE_AUTH_EMULATOR_HOST is set, unsigned emulator tokens are accepted instead",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if audience == "" {
+				return fmt.Errorf("--audience or FIREBASE_PROJECT_ID is required")
+			}
+			opts := []jwt.ValidatorOption{}
+			if emulatorHost := os.Getenv("FIREBASE_AUTH_EMULATOR_HOST"); emulatorHost != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "emulator mode: FIREBASE_AUTH_EMULATOR_HOST=%v is set, only unsigned emulator tokens are accepted\n", emulatorHost)
+				opts = append(opts, jwt.WithEmulator())
+			}
+			validator := jwt.NewValidator(opts...)
+			request := jwt.ValidateTokenRequest{Token: args[0], Audience: audience}
+			var token jwt.AuthToken
+			var err error
+			if sessionCookie {
+				token, err = validator.VerifySessionCookie(ctx, request)
+			} else {
+				token, err = validator.Validate(ctx, request)
+			}
+			if err != nil {
+				var validationErr *jwt.ValidationError
+				if errors.As(err, &validationErr) {
+					fmt.Fprintf(cmd.ErrOrStderr(), "kind:   %v\n", validationErr.Kind)
+					if validationErr.Reason != "" {
+						fmt.Fprintf(cmd.ErrOrStderr(), "reason: %v\n", validationErr.Reason)
+					}
+				}
+				return err
+			}
+			return printJSON(cmd.OutOrStdout(), token.AllClaims())
+		},
+	}
+	cmd.Flags().StringVar(&audience, "audience", os.Getenv("FIREBASE_PROJECT_ID"), "Firebase project ID the token must be issued for. Defaults to FIREBASE_PROJECT_ID")
+	cmd.Flags().BoolVar(&sessionCookie, "session-cookie", false, "verify a session cookie rather than an ID token")
+	return cmd
+}
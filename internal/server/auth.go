@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -9,10 +10,17 @@ import (
 
 	"github.com/bjarke-xyz/auth/pkg/jwt"
 	"github.com/samber/lo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/bjarke-xyz/auth/internal/server")
+
 var idTokenCookieKey = "ID_TOKEN"
 var refreshTokenCookieKey = "REFRESH_TOKEN"
+var sessionCookieKey = "SESSION"
 
 var (
 	IdTokenCtxKey      = &contextKey{"IdToken"}
@@ -31,10 +39,19 @@ func (s *server) handleLogout(w http.ResponseWriter, r *http.Request) {
 		Value:  "",
 		MaxAge: -1,
 	})
+	http.SetCookie(w, &http.Cookie{
+		Name:   sessionCookieKey,
+		Value:  "",
+		MaxAge: -1,
+	})
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
 func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	ctx, span := tracer.Start(r.Context(), "server.handleLogin")
+	defer span.End()
+	r = r.WithContext(ctx)
+
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 	if email == "" || password == "" {
@@ -44,6 +61,8 @@ func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 	resp, err := s.authClient.SignInWithEmailAndPassword(r.Context(), email, password)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sign in failed")
 		s.logger.Error("failed to login", "error", err)
 		http.Redirect(w, r, "/?error=internal error", http.StatusSeeOther)
 		return
@@ -59,18 +78,27 @@ func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 5 days
-	cookieExpires := time.Now().Add(5 * 24 * time.Hour)
+	sessionDuration := 5 * 24 * time.Hour
+	cookieExpires := time.Now().Add(sessionDuration)
+
+	firebaseAuth, err := s.app.Auth(r.Context())
+	if err != nil {
+		s.logger.Error("error getting auth", "error", err)
+		http.Redirect(w, r, "/?error=internal error", http.StatusSeeOther)
+		return
+	}
+	sessionCookie, err := firebaseAuth.SessionCookie(r.Context(), resp.IdToken, sessionDuration)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "session cookie creation failed")
+		s.logger.Error("failed to create session cookie", "error", err)
+		http.Redirect(w, r, "/?error=internal error", http.StatusSeeOther)
+		return
+	}
 
 	http.SetCookie(w, &http.Cookie{
-		Name:     idTokenCookieKey,
-		Value:    resp.IdToken,
-		Expires:  cookieExpires,
-		HttpOnly: true,
-		Secure:   true,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     refreshTokenCookieKey,
-		Value:    resp.RefreshToken,
+		Name:     sessionCookieKey,
+		Value:    sessionCookie,
 		Expires:  cookieExpires,
 		HttpOnly: true,
 		Secure:   true,
@@ -80,35 +108,83 @@ func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
 
 func (s *server) firebaseJwtVerifier(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		idTokenCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == idTokenCookieKey })
+		ctx, span := tracer.Start(r.Context(), "server.firebaseJwtVerifier")
+		token, refreshToken, ok := s.verifyCookies(ctx, w, r)
 		if !ok {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
+			span.SetStatus(codes.Error, "unauthorized")
 		}
-		refreshTokenCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == refreshTokenCookieKey })
+		span.End()
 		if !ok {
-			w.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-
-		if len(idTokenCookie.Value) == 0 || len(refreshTokenCookie.Value) == 0 {
-			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
+		// the span only covers verification, so the rest of the request is not traced as part of it
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), token, refreshToken, nil)))
+	})
+}
 
-		ctx := r.Context()
+// verifyCookies validates the session cookie, or the ID token cookie of older logins, and returns the token and refresh token.
+// If the request is not authorized it writes an error response and returns false
+func (s *server) verifyCookies(ctx context.Context, w http.ResponseWriter, r *http.Request) (jwt.AuthToken, string, bool) {
+	span := trace.SpanFromContext(ctx)
+	sessionCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == sessionCookieKey })
+	if ok && len(sessionCookie.Value) > 0 {
+		span.SetAttributes(attribute.String("auth.cookie", sessionCookieKey))
 		validateReq := jwt.ValidateTokenRequest{
-			Token:    idTokenCookie.Value,
+			Token:    sessionCookie.Value,
 			Audience: os.Getenv("FIREBASE_PROJECT_ID"),
 		}
-		token, err := jwt.ValidateToken(ctx, validateReq)
-		if !lo.Contains(s.allowedUsers, token.Subject) {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+		token, err := s.validator.VerifySessionCookie(ctx, validateReq)
+		if !s.authorizeToken(w, token, err) {
+			return jwt.AuthToken{}, "", false
 		}
-		ctx = NewContext(ctx, token, refreshTokenCookie.Value, err)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+		return token, "", true
+	}
+
+	// ID and refresh token cookies are set by logins from before session cookies were introduced
+	idTokenCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == idTokenCookieKey })
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return jwt.AuthToken{}, "", false
+	}
+	refreshTokenCookie, ok := lo.Find(r.Cookies(), func(c *http.Cookie) bool { return c.Name == refreshTokenCookieKey })
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		return jwt.AuthToken{}, "", false
+	}
+
+	if len(idTokenCookie.Value) == 0 || len(refreshTokenCookie.Value) == 0 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return jwt.AuthToken{}, "", false
+	}
+
+	span.SetAttributes(attribute.String("auth.cookie", idTokenCookieKey))
+	validateReq := jwt.ValidateTokenRequest{
+		Token:    idTokenCookie.Value,
+		Audience: os.Getenv("FIREBASE_PROJECT_ID"),
+	}
+	token, err := s.validator.Validate(ctx, validateReq)
+	if !s.authorizeToken(w, token, err) {
+		return jwt.AuthToken{}, "", false
+	}
+	return token, refreshTokenCookie.Value, true
+}
+
+// authorizeToken writes an error response and returns false if the token is invalid or its user is not allowed
+func (s *server) authorizeToken(w http.ResponseWriter, token jwt.AuthToken, err error) bool {
+	if errors.Is(err, jwt.ErrKeysUnavailable) || errors.Is(err, jwt.ErrRevocationUnavailable) {
+		s.logger.Error("failed to validate token", "error", err)
+		http.Error(w, "service unavailable", http.StatusServiceUnavailable)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	if !lo.Contains(s.allowedUsers, token.Subject) {
+		http.Error(w, "user not allowed", http.StatusUnauthorized)
+		return false
+	}
+	return true
 }
 
 type contextKey struct {
@@ -116,6 +192,7 @@ type contextKey struct {
 }
 
 func NewContext(ctx context.Context, t jwt.AuthToken, refreshToken string, err error) context.Context {
+	ctx = jwt.NewContext(ctx, t)
 	ctx = context.WithValue(ctx, IdTokenCtxKey, t)
 	ctx = context.WithValue(ctx, RefreshTokenCtxKey, refreshToken)
 	ctx = context.WithValue(ctx, ErrorCtxKey, err)
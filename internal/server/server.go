@@ -13,8 +13,11 @@ import (
 	fbAuth "firebase.google.com/go/v4/auth"
 	"github.com/bjarke-xyz/auth/internal/server/html"
 	"github.com/bjarke-xyz/auth/internal/service"
+	"github.com/bjarke-xyz/auth/pkg/authz"
+	"github.com/bjarke-xyz/auth/pkg/jwt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"golang.org/x/exp/slog"
 	"google.golang.org/api/iterator"
 )
@@ -27,30 +30,34 @@ type server struct {
 
 	app        *firebase.App
 	authClient *service.FirebaseAuthRestClient
+	validator  *jwt.Validator
 
-	allowedUsers []string
+	allowedUsers      []string
+	adminRequirements []authz.Requirement
 
 	staticFilesFs fs.FS
 }
 
-func NewServer(ctx context.Context, logger *slog.Logger, app *firebase.App, authClient *service.FirebaseAuthRestClient, allowedUsers []string) (*server, error) {
+func NewServer(ctx context.Context, logger *slog.Logger, app *firebase.App, authClient *service.FirebaseAuthRestClient, validator *jwt.Validator, allowedUsers []string, adminRequirements ...authz.Requirement) (*server, error) {
 	staticFilesFs, err := fs.Sub(staticFiles, "static")
 	if err != nil {
 		return nil, err
 	}
 	return &server{
-		logger:        logger,
-		app:           app,
-		authClient:    authClient,
-		allowedUsers:  allowedUsers,
-		staticFilesFs: staticFilesFs,
+		logger:            logger,
+		app:               app,
+		authClient:        authClient,
+		validator:         validator,
+		allowedUsers:      allowedUsers,
+		adminRequirements: adminRequirements,
+		staticFilesFs:     staticFilesFs,
 	}, nil
 }
 
 func (s *server) Server(port int) *http.Server {
 	return &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: s.Routes(),
+		Handler: otelhttp.NewHandler(s.Routes(), "server"), // continues traces from incoming requests
 	}
 
 }
@@ -78,6 +85,9 @@ func (s *server) Routes() *chi.Mux {
 
 	r.Route("/admin", func(r chi.Router) {
 		r.Use(s.firebaseJwtVerifier)
+		if len(s.adminRequirements) > 0 {
+			r.Use(authz.Require(s.adminRequirements...))
+		}
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 			// token, _, _ := TokenFromContext(r.Context())
 			firebaseAuth, _ := s.app.Auth(r.Context())
@@ -8,11 +8,20 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
+var tracer = otel.Tracer("github.com/bjarke-xyz/auth/internal/service")
+
+const identityToolkitURL = "https://identitytoolkit.googleapis.com"
+
 type FirebaseAuthRestClient struct {
 	apiKey     string
 	projectId  string
+	baseURL    string
 	httpClient *http.Client
 }
 
@@ -20,12 +29,21 @@ func NewFirebaseAuthRestClient(apiKey string, projectId string) *FirebaseAuthRes
 	return &FirebaseAuthRestClient{
 		apiKey:    apiKey,
 		projectId: projectId,
+		baseURL:   identityToolkitURL,
 		httpClient: &http.Client{
 			Timeout: time.Second * 100,
 		},
 	}
 }
 
+// NewFirebaseAuthEmulatorRestClient creates a client that sends requests to the Firebase Auth emulator
+// running at emulatorHost, e.g. "localhost:9099", the value of FIREBASE_AUTH_EMULATOR_HOST
+func NewFirebaseAuthEmulatorRestClient(emulatorHost string, apiKey string, projectId string) *FirebaseAuthRestClient {
+	client := NewFirebaseAuthRestClient(apiKey, projectId)
+	client.baseURL = "http://" + emulatorHost + "/identitytoolkit.googleapis.com"
+	return client
+}
+
 type ErrorResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
@@ -46,7 +64,10 @@ type IdTokenResponse struct {
 }
 
 func (f *FirebaseAuthRestClient) SignInWithEmailAndPassword(ctx context.Context, email string, password string) (IdTokenResponse, error) {
-	url := "https://identitytoolkit.googleapis.com/v1/accounts:signInWithPassword?key=" + f.apiKey
+	// the url is not recorded, since it contains the api key
+	ctx, span := tracer.Start(ctx, "FirebaseAuthRestClient.SignInWithEmailAndPassword")
+	defer span.End()
+	url := f.baseURL + "/v1/accounts:signInWithPassword?key=" + f.apiKey
 	body := make(map[string]string, 0)
 	body["email"] = email
 	body["password"] = password
@@ -62,9 +83,12 @@ func (f *FirebaseAuthRestClient) SignInWithEmailAndPassword(ctx context.Context,
 	}
 	resp, err := f.httpClient.Do(req)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "request failed")
 		return IdTokenResponse{}, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 	respBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return IdTokenResponse{}, fmt.Errorf("error reading response: %w", err)
@@ -0,0 +1,177 @@
+// Package authz authorizes requests based on the claims of a validated token
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+)
+
+// ErrForbidden is matched by every error returned by a Requirement. It is the same error as jwt.ErrForbidden
+var ErrForbidden = jwt.ErrForbidden
+
+// ForbiddenError describes which requirement a token did not meet
+type ForbiddenError struct {
+	Reason string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrForbidden, e.Reason)
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return ErrForbidden
+}
+
+func forbidden(format string, args ...any) error {
+	return &ForbiddenError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Requirement returns nil if the token is authorized, and a ForbiddenError otherwise
+type Requirement func(token jwt.AuthToken) error
+
+// Check returns the error of the first requirement the token does not meet
+func Check(token jwt.AuthToken, requirements ...Requirement) error {
+	return All(requirements...)(token)
+}
+
+// All requires every requirement to be met
+func All(requirements ...Requirement) Requirement {
+	return func(token jwt.AuthToken) error {
+		for _, requirement := range requirements {
+			if err := requirement(token); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Any requires at least one of the requirements to be met
+func Any(requirements ...Requirement) Requirement {
+	return func(token jwt.AuthToken) error {
+		if len(requirements) == 0 {
+			return nil
+		}
+		reasons := make([]string, 0, len(requirements))
+		for _, requirement := range requirements {
+			err := requirement(token)
+			if err == nil {
+				return nil
+			}
+			var forbiddenErr *ForbiddenError
+			if errors.As(err, &forbiddenErr) {
+				reasons = append(reasons, forbiddenErr.Reason)
+			} else {
+				reasons = append(reasons, err.Error())
+			}
+		}
+		return forbidden("none of: %v", strings.Join(reasons, "; "))
+	}
+}
+
+// HasRole requires the role claim to be one of roles
+func HasRole(roles ...string) Requirement {
+	return func(token jwt.AuthToken) error {
+		if !slices.Contains(roles, token.Role) {
+			return forbidden("role %q is not one of %v", token.Role, roles)
+		}
+		return nil
+	}
+}
+
+// InAnyGroup requires the groups claim to contain at least one of groups
+func InAnyGroup(groups ...string) Requirement {
+	return func(token jwt.AuthToken) error {
+		for _, group := range groups {
+			if slices.Contains(token.Groups, group) {
+				return nil
+			}
+		}
+		return forbidden("not in any of the groups %v", groups)
+	}
+}
+
+// HasProduct requires the products claim to contain product
+func HasProduct(product string) Requirement {
+	return func(token jwt.AuthToken) error {
+		if !slices.Contains(token.Products, product) {
+			return forbidden("product %q missing", product)
+		}
+		return nil
+	}
+}
+
+// ClaimEquals requires the claim to have the value. Numbers compare by value regardless of their Go type
+func ClaimEquals(name string, value any) Requirement {
+	return func(token jwt.AuthToken) error {
+		actual, ok := token.AllClaims()[name]
+		if !ok {
+			return forbidden("claim %v missing", name)
+		}
+		if !valuesEqual(actual, value) {
+			return forbidden("claim %v is %v, expected %v", name, actual, value)
+		}
+		return nil
+	}
+}
+
+// ClaimContains requires the claim to be a list containing value
+func ClaimContains(name string, value any) Requirement {
+	return func(token jwt.AuthToken) error {
+		actual, ok := token.AllClaims()[name]
+		if !ok {
+			return forbidden("claim %v missing", name)
+		}
+		list, ok := actual.([]any)
+		if !ok {
+			return forbidden("claim %v is not a list", name)
+		}
+		for _, item := range list {
+			if valuesEqual(item, value) {
+				return nil
+			}
+		}
+		return forbidden("claim %v does not contain %v", name, value)
+	}
+}
+
+// valuesEqual compares a claim decoded from JSON with a Go value
+func valuesEqual(claim any, value any) bool {
+	if claimNumber, ok := claim.(float64); ok {
+		v := reflect.ValueOf(value)
+		switch {
+		case v.CanInt():
+			return claimNumber == float64(v.Int())
+		case v.CanUint():
+			return claimNumber == float64(v.Uint())
+		case v.CanFloat():
+			return claimNumber == v.Float()
+		}
+	}
+	return reflect.DeepEqual(claim, value)
+}
+
+// Require is middleware that responds with 403 Forbidden and the reason when the token in the request context,
+// see jwt.Middleware, does not meet the requirements. Requests without a token get 401 Unauthorized
+func Require(requirements ...Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := jwt.FromContext(r.Context())
+			if !ok {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			if err := Check(token, requirements...); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/authz"
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+// validToken mints a token with the claims and validates it, so the requirements see the token as a server would
+func validToken(t *testing.T, s *jwttest.Server, claims map[string]any) jwt.AuthToken {
+	t.Helper()
+	token, err := s.Validator().Validate(context.Background(), jwt.ValidateTokenRequest{Token: s.Mint("user", claims), Audience: s.ProjectID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRequirements(t *testing.T) {
+	s := jwttest.NewServer(t)
+	claims := map[string]any{
+		"role":           "admin",
+		"groups":         []string{"ops", "billing"},
+		"products":       []string{"rides"},
+		"email_verified": false,
+		"seats":          0,
+		"tier":           "",
+		"tags":           []any{"a", 2},
+	}
+	token := validToken(t, s, claims)
+
+	tests := []struct {
+		name        string
+		requirement authz.Requirement
+		allowed     bool
+	}{
+		{"role matches", authz.HasRole("viewer", "admin"), true},
+		{"role does not match", authz.HasRole("viewer"), false},
+		{"in group", authz.InAnyGroup("support", "billing"), true},
+		{"not in group", authz.InAnyGroup("support"), false},
+		{"has product", authz.HasProduct("rides"), true},
+		{"missing product", authz.HasProduct("eats"), false},
+		{"claim equals false", authz.ClaimEquals("email_verified", false), true},
+		{"claim equals true", authz.ClaimEquals("email_verified", true), false},
+		{"claim equals zero", authz.ClaimEquals("seats", 0), true},
+		{"claim equals empty string", authz.ClaimEquals("tier", ""), true},
+		{"claim equals string", authz.ClaimEquals("role", "admin"), true},
+		{"claim missing", authz.ClaimEquals("missing", nil), false},
+		{"claim contains string", authz.ClaimContains("tags", "a"), true},
+		{"claim contains number", authz.ClaimContains("tags", 2), true},
+		{"claim does not contain", authz.ClaimContains("tags", "b"), false},
+		{"claim not a list", authz.ClaimContains("role", "admin"), false},
+		{"all met", authz.All(authz.HasRole("admin"), authz.HasProduct("rides")), true},
+		{"all not met", authz.All(authz.HasRole("admin"), authz.HasProduct("eats")), false},
+		{"any met", authz.Any(authz.HasRole("viewer"), authz.HasProduct("rides")), true},
+		{"any not met", authz.Any(authz.HasRole("viewer"), authz.HasProduct("eats")), false},
+		{"any of none", authz.Any(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authz.Check(token, tt.requirement)
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("expected token to be allowed, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, authz.ErrForbidden) {
+				t.Fatalf("expected ErrForbidden, got %v", err)
+			}
+			var forbiddenErr *authz.ForbiddenError
+			if !errors.As(err, &forbiddenErr) || forbiddenErr.Reason == "" {
+				t.Errorf("expected a ForbiddenError with a reason, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	s := jwttest.NewServer(t)
+	handler := authz.Require(authz.HasRole("admin"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name       string
+		ctx        func(context.Context) context.Context
+		wantStatus int
+	}{
+		{"no token", func(ctx context.Context) context.Context { return ctx }, http.StatusUnauthorized},
+		{"forbidden", func(ctx context.Context) context.Context {
+			return jwt.NewContext(ctx, validToken(t, s, map[string]any{"role": "viewer"}))
+		}, http.StatusForbidden},
+		{"allowed", func(ctx context.Context) context.Context {
+			return jwt.NewContext(ctx, validToken(t, s, map[string]any{"role": "admin"}))
+		}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(tt.ctx(r.Context()))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %v, got %v: %v", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
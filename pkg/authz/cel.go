@@ -0,0 +1,141 @@
+package authz
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/google/cel-go/cel"
+)
+
+// Policy is a compiled CEL expression over the claims of a token. The expression must evaluate to a bool and can use the variables
+//
+//	token, claims  map of every claim, e.g. token.firebase.sign_in_provider
+//	role, uid, email, project_id  string
+//	groups, products  list of strings
+//	email_verified  bool
+//
+// e.g. "role == 'admin' || 'billing' in groups && token.firebase.sign_in_provider != 'anonymous'".
+// Policies are safe for concurrent use, and can be unit tested by calling Eval with sample tokens
+type Policy struct {
+	expr    string
+	program cel.Program
+}
+
+var (
+	celEnvOnce sync.Once
+	celEnv     *cel.Env
+	celEnvErr  error
+
+	policyCache sync.Map
+)
+
+func policyEnv() (*cel.Env, error) {
+	celEnvOnce.Do(func() {
+		claimsType := cel.MapType(cel.StringType, cel.DynType)
+		celEnv, celEnvErr = cel.NewEnv(
+			cel.Variable("token", claimsType),
+			cel.Variable("claims", claimsType),
+			cel.Variable("role", cel.StringType),
+			cel.Variable("uid", cel.StringType),
+			cel.Variable("email", cel.StringType),
+			cel.Variable("project_id", cel.StringType),
+			cel.Variable("groups", cel.ListType(cel.StringType)),
+			cel.Variable("products", cel.ListType(cel.StringType)),
+			cel.Variable("email_verified", cel.BoolType),
+		)
+	})
+	return celEnv, celEnvErr
+}
+
+// CompilePolicy compiles and type checks the expression. Compiled policies are cached by expression
+func CompilePolicy(expr string) (*Policy, error) {
+	if cached, ok := policyCache.Load(expr); ok {
+		return cached.(*Policy), nil
+	}
+	env, err := policyEnv()
+	if err != nil {
+		return nil, fmt.Errorf("error creating cel environment: %w", err)
+	}
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("error compiling policy %q: %w", expr, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("policy %q must evaluate to bool, not %v", expr, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("error creating program for policy %q: %w", expr, err)
+	}
+	policy := &Policy{expr: expr, program: program}
+	cached, _ := policyCache.LoadOrStore(expr, policy)
+	return cached.(*Policy), nil
+}
+
+// MustCompilePolicy is like CompilePolicy but panics if the expression is invalid
+func MustCompilePolicy(expr string) *Policy {
+	policy, err := CompilePolicy(expr)
+	if err != nil {
+		panic(err)
+	}
+	return policy
+}
+
+func (p *Policy) String() string {
+	return p.expr
+}
+
+// Eval reports whether the token satisfies the policy
+func (p *Policy) Eval(token jwt.AuthToken) (bool, error) {
+	claims := token.AllClaims()
+	out, _, err := p.program.Eval(map[string]any{
+		"token":          claims,
+		"claims":         claims,
+		"role":           token.Role,
+		"uid":            token.UID,
+		"email":          token.Email,
+		"project_id":     token.ProjectID,
+		"groups":         nonNil(token.Groups),
+		"products":       nonNil(token.Products),
+		"email_verified": token.EmailVerified,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error evaluating policy %q: %w", p.expr, err)
+	}
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("policy %q evaluated to %v, not bool", p.expr, out.Value())
+	}
+	return allowed, nil
+}
+
+// Requirement returns a Requirement that is met when the policy evaluates to true
+func (p *Policy) Requirement() Requirement {
+	return func(token jwt.AuthToken) error {
+		allowed, err := p.Eval(token)
+		if err != nil {
+			return forbidden("%v", err)
+		}
+		if !allowed {
+			return forbidden("policy %q not satisfied", p.expr)
+		}
+		return nil
+	}
+}
+
+// CEL compiles the expression into a Requirement, see Policy
+func CEL(expr string) (Requirement, error) {
+	policy, err := CompilePolicy(expr)
+	if err != nil {
+		return nil, err
+	}
+	return policy.Requirement(), nil
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,76 @@
+package authz_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/authz"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestPolicyEval(t *testing.T) {
+	s := jwttest.NewServer(t)
+	token := validToken(t, s, map[string]any{
+		"role":           "admin",
+		"groups":         []string{"billing"},
+		"email":          "user@example.com",
+		"email_verified": false,
+		"seats":          0,
+		"firebase":       map[string]any{"sign_in_provider": "password"},
+	})
+
+	tests := []struct {
+		expr    string
+		allowed bool
+		wantErr bool
+	}{
+		{"role == 'admin'", true, false},
+		{"role == 'viewer'", false, false},
+		{"'billing' in groups && token.firebase.sign_in_provider != 'anonymous'", true, false},
+		{"token.email_verified == false", true, false},
+		{"email_verified", false, false},
+		{"claims.seats == 0", true, false},
+		{"uid == 'user' && project_id == '" + jwttest.DefaultProjectID + "'", true, false},
+		{"email.endsWith('@example.com')", true, false},
+		{"has(token.tier)", false, false},
+		{"'rides' in products", false, false},
+		{"token.tier == 'gold'", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			policy, err := authz.CompilePolicy(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			allowed, err := policy.Eval(token)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", allowed)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != tt.allowed {
+				t.Errorf("expected %v, got %v", tt.allowed, allowed)
+			}
+
+			err = policy.Requirement()(token)
+			if tt.allowed != (err == nil) {
+				t.Errorf("expected allowed=%v from the requirement, got %v", tt.allowed, err)
+			}
+			if err != nil && !errors.Is(err, authz.ErrForbidden) {
+				t.Errorf("expected ErrForbidden, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompilePolicyErrors(t *testing.T) {
+	for _, expr := range []string{"role ==", "role", "unknown == 'x'"} {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := authz.CEL(expr); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
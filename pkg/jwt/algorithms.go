@@ -0,0 +1,47 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SupportedAlgorithms are the asymmetric signing algorithms tokens may be signed with
+var SupportedAlgorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// keyMatchesMethod reports whether key can verify signatures made with method
+func keyMatchesMethod(method jwt.SigningMethod, key crypto.PublicKey) bool {
+	switch m := method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		return ok && ecKey.Curve.Params().BitSize == m.CurveBits
+	case *jwt.SigningMethodEd25519:
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	default:
+		return false
+	}
+}
+
+// supportedAlgorithms filters algorithms down to the ones in SupportedAlgorithms
+func supportedAlgorithms(algorithms []string) []string {
+	supported := make([]string, 0, len(algorithms))
+	for _, alg := range algorithms {
+		if slices.Contains(SupportedAlgorithms, alg) {
+			supported = append(supported, alg)
+		}
+	}
+	return supported
+}
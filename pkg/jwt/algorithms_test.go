@@ -0,0 +1,100 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestValidateAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPublicKey)},
+	}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		_ = json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	const project = "proj"
+	v := jwt.NewValidator(
+		jwt.WithKeyRetreiver(jwt.NewJWKSKeyRetreiver(server.URL)),
+		jwt.WithAllowedAlgorithms(jwt.SupportedAlgorithms...),
+	)
+	mint := func(method gojwt.SigningMethod, kid string, key crypto.Signer) string {
+		now := time.Now()
+		token := gojwt.NewWithClaims(method, gojwt.MapClaims{
+			"iss": "https://securetoken.google.com/" + project, "aud": project, "sub": "user",
+			"iat": now.Unix(), "exp": now.Add(time.Hour).Unix(), "auth_time": now.Unix(),
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		algorithms []string
+		wantErr    error
+	}{
+		{"RS256", mint(gojwt.SigningMethodRS256, "rsa", rsaKey), nil, nil},
+		{"PS256", mint(gojwt.SigningMethodPS256, "rsa", rsaKey), nil, nil},
+		{"ES256", mint(gojwt.SigningMethodES256, "ec", ecKey), nil, nil},
+		{"EdDSA", mint(gojwt.SigningMethodEdDSA, "ed", edKey), nil, nil},
+		// signed with the RSA key, but claiming the kid of the EC key
+		{"key does not match alg", mint(gojwt.SigningMethodRS256, "ec", rsaKey), nil, jwt.ErrSignatureInvalid},
+		{"alg allowed for issuer", mint(gojwt.SigningMethodES256, "ec", ecKey), []string{"ES256"}, nil},
+		{"alg not allowed for issuer", mint(gojwt.SigningMethodRS256, "rsa", rsaKey), []string{"ES256"}, jwt.ErrSignatureInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Validate(context.Background(), jwt.ValidateTokenRequest{
+				Token:   tt.token,
+				Trusted: []jwt.TrustedIssuer{{Audience: project, Algorithms: tt.algorithms}},
+			})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected token to be valid, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package jwt_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+// pemKeyRetreiver parses the PEM encoded certificates on every call, as keys were handled before they were cached parsed
+type pemKeyRetreiver struct {
+	certs map[string]string
+}
+
+func (r pemKeyRetreiver) GetKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	keys := make(map[string]crypto.PublicKey, len(r.certs))
+	for kid, certPem := range r.certs {
+		block, _ := pem.Decode([]byte(certPem))
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		keys[kid] = cert.PublicKey
+	}
+	return keys, nil
+}
+
+func BenchmarkValidate(b *testing.B) {
+	s := jwttest.NewServer(b)
+	token := s.Mint("user", nil)
+	request := jwt.ValidateTokenRequest{Token: token, Audience: s.ProjectID}
+	ctx := context.Background()
+
+	validators := []struct {
+		name      string
+		validator *jwt.Validator
+	}{
+		{"cached", s.Validator()},
+		{"parse-pem", jwt.NewValidator(jwt.WithKeyRetreiver(pemKeyRetreiver{certs: map[string]string{s.KeyID: s.Certificate}}))},
+	}
+	for _, v := range validators {
+		b.Run(v.name, func(b *testing.B) {
+			_, err := v.validator.Validate(ctx, request)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_, err := v.validator.Validate(ctx, request)
+					if err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
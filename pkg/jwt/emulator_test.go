@@ -0,0 +1,47 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestEmulatorTokens(t *testing.T) {
+	s := jwttest.NewServer(t)
+	unsigned := s.Mint("user", nil, jwttest.WithSigningMethod(gojwt.SigningMethodNone))
+	signed := s.Mint("user", nil)
+
+	tests := []struct {
+		name      string
+		validator *jwt.Validator
+		token     string
+		wantValid bool
+	}{
+		{"unsigned token without emulator", s.Validator(), unsigned, false},
+		{"unsigned token with emulator", s.Validator(jwt.WithEmulator()), unsigned, true},
+		{"signed token with emulator", s.Validator(jwt.WithEmulator()), signed, false},
+		// only WithEmulator accepts alg none, allowing it as an algorithm does not
+		{"unsigned token with none allowed", s.Validator(jwt.WithAllowedAlgorithms("none")), unsigned, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.validator.Validate(context.Background(), jwt.ValidateTokenRequest{Token: tt.token, Audience: s.ProjectID})
+			if !tt.wantValid {
+				if !errors.Is(err, jwt.ErrValidation) {
+					t.Fatalf("expected a validation error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.UID != "user" {
+				t.Errorf("expected uid user, got %v", token.UID)
+			}
+		})
+	}
+}
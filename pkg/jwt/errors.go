@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrValidation is matched by every error caused by the token itself
+var ErrValidation = errors.New("validation error")
+
+// Categories of validation errors. Every ValidationError matches ErrValidation and exactly one of these
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrSignatureInvalid = errors.New("invalid signature")
+	ErrUnknownKeyID     = errors.New("unknown key id")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token not yet valid")
+	ErrAudienceMismatch = errors.New("audience mismatch")
+	ErrIssuerMismatch   = errors.New("issuer mismatch")
+
+	// Policy errors, see ValidateTokenRequest
+	ErrEmailNotVerified         = errors.New("email not verified")
+	ErrSignInProviderNotAllowed = errors.New("sign in provider not allowed")
+	ErrAuthTooOld               = errors.New("authentication too old")
+	ErrRequiredClaim            = errors.New("required claim missing or mismatched")
+
+	// Revocation errors, see RevocationChecker
+	ErrTokenRevoked = errors.New("token revoked")
+	ErrUserDisabled = errors.New("user disabled")
+)
+
+// ErrKeysUnavailable is returned when the keys needed to verify a token could not be retreived.
+// It does not match ErrValidation, since the token may well be valid
+var ErrKeysUnavailable = errors.New("keys unavailable")
+
+// ErrRevocationUnavailable is returned when the RevocationChecker could not determine whether a token is revoked
+var ErrRevocationUnavailable = errors.New("revocation check unavailable")
+
+// ValidationError describes why a token was rejected
+type ValidationError struct {
+	// Kind is one of the error categories, e.g. ErrExpired
+	Kind error
+	// Reason is a human readable description
+	Reason string
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("%v: %v", ErrValidation, e.Kind)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := []error{ErrValidation, e.Kind}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+func newValidationError(kind error, reason string, err error) error {
+	return &ValidationError{Kind: kind, Reason: reason, Err: err}
+}
+
+// classifyParseError maps errors returned by the jwt parser to a ValidationError
+func classifyParseError(err error) error {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr
+	}
+	if errors.Is(err, ErrKeysUnavailable) {
+		return err
+	}
+	kind := ErrMalformed
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		kind = ErrMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		kind = ErrSignatureInvalid
+	case errors.Is(err, jwt.ErrTokenExpired):
+		kind = ErrExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		kind = ErrNotYetValid
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		kind = ErrAudienceMismatch
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		kind = ErrIssuerMismatch
+	}
+	return newValidationError(kind, "", err)
+}
@@ -0,0 +1,39 @@
+package jwt
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJWKSWithoutMaxAgeUsesDefaultMaxAge(t *testing.T) {
+	now := time.Now().UTC()
+	clock := func() time.Time { return now }
+	for _, cacheControl := range []string{"", "no-cache", "public, max-age=abc"} {
+		t.Run(cacheControl, func(t *testing.T) {
+			server := newKeyServer(t)
+			server.cacheControl = cacheControl
+			kr := NewJWKSKeyRetreiver(server.URL, WithKeysClock(clock))
+			keys, err := kr.GetKeys(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys["kid1"] == nil {
+				t.Error("kid1 missing")
+			}
+			if got, want := kr.Stats().ExpiresAt, now.Add(time.Hour); !got.Equal(want) {
+				t.Errorf("expected keys to expire at %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestKeysWithoutMaxAgeFailWithoutDefault(t *testing.T) {
+	server := newKeyServer(t)
+	server.cacheControl = ""
+	ks := newRemoteKeySet(server.URL, parseJWKS)
+	_, err := ks.GetKeys(context.Background())
+	if err == nil {
+		t.Fatal("expected an error without max-age")
+	}
+}
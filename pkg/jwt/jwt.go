@@ -2,136 +2,177 @@ package jwt
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"errors"
-	"fmt"
+	"encoding/json"
+	"maps"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var keyRetreiver = NewGoogleKeyRetreiver()
-
-var ErrValidation = errors.New("validation error")
+var defaultValidator = NewValidator()
 
+// ValidateToken validates a Firebase ID token using the default Validator
 func ValidateToken(ctx context.Context, request ValidateTokenRequest) (AuthToken, error) {
-	keys, err := keyRetreiver.GetKeys(ctx)
-	if err != nil {
-		return AuthToken{}, fmt.Errorf("error getting keys: %w", err)
-	}
-	token, err := jwt.Parse(request.Token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, fmt.Errorf("%w: unexpected signing method: %v", ErrValidation, token.Header["alg"])
-		}
-		kid, ok := token.Header["kid"]
-		if !ok {
-			return nil, fmt.Errorf("%w: kid not found in token header", ErrValidation)
-		}
-		kidStr, ok := kid.(string)
-		if !ok {
-			return nil, fmt.Errorf("%w: kid was not a string", ErrValidation)
-		}
-		key, ok := keys[kidStr]
-		if !ok {
-			return nil, fmt.Errorf("%w: key not found for kid %v", ErrValidation, kidStr)
-		}
-		block, _ := pem.Decode([]byte(key))
-		cert, err := x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			return nil, fmt.Errorf("%w: failed to parse certificate", ErrValidation)
-		}
-		publicKey := cert.PublicKey.(*rsa.PublicKey)
-		return publicKey, nil
-	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithAudience(request.Audience), jwt.WithIssuer("https://securetoken.google.com/"+request.Audience))
-	if err != nil {
-		return AuthToken{}, fmt.Errorf("%w: %w", ErrValidation, err)
+	return defaultValidator.Validate(ctx, request)
+}
+
+// VerifySessionCookie validates a Firebase session cookie using the default Validator
+func VerifySessionCookie(ctx context.Context, request ValidateTokenRequest) (AuthToken, error) {
+	return defaultValidator.VerifySessionCookie(ctx, request)
+}
+
+// ValidateTokenInto validates a Firebase ID token using the default Validator and decodes its claims into T
+func ValidateTokenInto[T any](ctx context.Context, request ValidateTokenRequest) (T, error) {
+	return ValidateInto[T](ctx, defaultValidator, request)
+}
+
+type AuthToken struct {
+	AuthTime float64 `json:"auth_time,omitempty"`
+	Issuer   string  `json:"iss,omitempty"`
+	// Audience is the audience the token was accepted for. Before validation it is the first of Audiences
+	Audience string `json:"aud,omitempty"`
+	// Audiences holds every audience of the token. aud is a string in Firebase tokens, but may be an array in tokens from other OIDC issuers
+	Audiences []string `json:"-"`
+	Expires   float64  `json:"exp,omitempty"`
+	IssuedAt  float64  `json:"iat,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	UID       string   `json:"user_id,omitempty"`
+	// ProjectID is the trusted audience the token was accepted for
+	ProjectID string `json:"-"`
+	// Claims holds every claim that is not mapped to a field
+	Claims   map[string]any `json:"-"`
+	Products []string       `json:"products,omitempty"`
+	Role     string         `json:"role,omitempty"`
+	Groups   []string       `json:"groups,omitempty"`
+
+	Email         string       `json:"email,omitempty"`
+	EmailVerified bool         `json:"email_verified,omitempty"`
+	PhoneNumber   string       `json:"phone_number,omitempty"`
+	Name          string       `json:"name,omitempty"`
+	Picture       string       `json:"picture,omitempty"`
+	Firebase      FirebaseInfo `json:"firebase,omitempty"`
+
+	// payload holds every claim of a decoded token as it was, including false, 0 and "" values the fields cannot tell apart from missing claims
+	payload map[string]any
+}
+
+// FirebaseInfo is the firebase claim of a Firebase ID token
+type FirebaseInfo struct {
+	// SignInProvider is e.g. "password", "google.com", "phone", "anonymous" or "custom"
+	SignInProvider string `json:"sign_in_provider,omitempty"`
+	// SignInSecondFactor is the second factor used, e.g. "phone", if the user signed in with multi factor authentication
+	SignInSecondFactor     string `json:"sign_in_second_factor,omitempty"`
+	SecondFactorIdentifier string `json:"second_factor_identifier,omitempty"`
+	Tenant                 string `json:"tenant,omitempty"`
+	// Identities maps each linked provider to the user's identifiers with that provider
+	Identities map[string][]string `json:"identities,omitempty"`
+}
+
+// authTokenClaims are the claims mapped to AuthToken fields
+var authTokenClaims = []string{"auth_time", "iss", "aud", "exp", "iat", "sub", "user_id", "products", "role", "groups",
+	"email", "email_verified", "phone_number", "name", "picture", "firebase"}
+
+// AllClaims returns the claims of the token, both those mapped to fields and those in Claims.
+// For a decoded token these are the claims as they were in the token. A token built in code has no
+// payload, so its claims are built from the fields, leaving out those with zero values
+func (t AuthToken) AllClaims() map[string]any {
+	if t.payload != nil {
+		return maps.Clone(t.payload)
 	}
-	if !token.Valid {
-		return AuthToken{}, fmt.Errorf("%w: token not valid", ErrValidation)
+	claims := make(map[string]any, len(t.Claims)+len(authTokenClaims))
+	data, err := json.Marshal(t)
+	if err == nil {
+		_ = json.Unmarshal(data, &claims)
 	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return AuthToken{}, fmt.Errorf("%w: failed to get token map claims", ErrValidation)
+	// omitempty does not leave out structs, so an unset Firebase would be firebase: {}
+	for k, v := range claims {
+		if m, ok := v.(map[string]any); ok && len(m) == 0 {
+			delete(claims, k)
+		}
 	}
-	authTimeIface, ok := claims["auth_time"]
-	if !ok {
-		return AuthToken{}, fmt.Errorf("%w: claim auth_time not found", ErrValidation)
+	for k, v := range t.Claims {
+		claims[k] = v
 	}
-	authTime, ok := authTimeIface.(float64)
-	if !ok {
-		return AuthToken{}, fmt.Errorf("%w: claim auth_time has invalid type", ErrValidation)
+	return claims
+}
+
+func (t *AuthToken) UnmarshalJSON(data []byte) error {
+	type authToken AuthToken
+	decoded := struct {
+		*authToken
+		Audience jwt.ClaimStrings `json:"aud,omitempty"`
+		Products lenientStrings   `json:"products,omitempty"`
+		Groups   lenientStrings   `json:"groups,omitempty"`
+	}{authToken: &authToken{}}
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
 	}
-	// auth_time must be in the past
-	now := float64(time.Now().UTC().Unix())
-	if authTime > now {
-		return AuthToken{}, fmt.Errorf("%w: auth_time must be in the past. auth_time=%f now=%f", ErrValidation, authTime, now)
+	decoded.authToken.Audiences = decoded.Audience
+	decoded.authToken.Products = decoded.Products
+	decoded.authToken.Groups = decoded.Groups
+	if len(decoded.Audience) > 0 {
+		decoded.authToken.Audience = decoded.Audience[0]
 	}
-	authToken := AuthToken{
-		Claims: make(map[string]any),
+	claims := make(map[string]any)
+	err = json.Unmarshal(data, &claims)
+	if err != nil {
+		return err
 	}
-	for k, v := range claims {
-		switch k {
-		case "auth_time":
-			authToken.AuthTime = v.(float64)
-		case "iss":
-			authToken.Issuer = v.(string)
-		case "aud":
-			authToken.Audience = v.(string)
-		case "exp":
-			authToken.Expires = v.(float64)
-		case "iat":
-			authToken.IssuedAt = v.(float64)
-		case "sub":
-			authToken.Subject = v.(string)
-		case "user_id":
-			authToken.UID = v.(string)
-		case "role":
-			authToken.Role = v.(string)
-		case "products":
-			authToken.Products = convertToArrayString(v)
-		case "groups":
-			authToken.Groups = convertToArrayString(v)
-		default:
-			authToken.Claims[k] = v
-		}
+	decoded.payload = maps.Clone(claims)
+	for _, claim := range authTokenClaims {
+		delete(claims, claim)
 	}
-	return authToken, nil
+	decoded.Claims = claims
+	*t = AuthToken(*decoded.authToken)
+	return nil
 }
 
-func convertToArrayString(val any) []string {
-	ifaceList, ok := val.([]any)
-	if !ok {
-		return []string{}
+// lenientStrings decodes custom claims set by other tools, which are not always lists of strings.
+// A single string is a list of one, entries that are not strings are empty, and any other value is no list
+type lenientStrings []string
+
+func (l *lenientStrings) UnmarshalJSON(data []byte) error {
+	var val any
+	err := json.Unmarshal(data, &val)
+	if err != nil {
+		return err
 	}
-	strList := make([]string, len(ifaceList))
-	for i, ifaceVal := range ifaceList {
-		strVal, ok := ifaceVal.(string)
-		if ok {
-			strList[i] = strVal
-		} else {
-			strList[i] = ""
+	switch val := val.(type) {
+	case string:
+		*l = []string{val}
+	case []any:
+		strList := make([]string, len(val))
+		for i, ifaceVal := range val {
+			strList[i], _ = ifaceVal.(string)
 		}
+		*l = strList
+	default:
+		*l = nil
 	}
-	return strList
+	return nil
 }
 
-type AuthToken struct {
-	AuthTime float64
-	Issuer   string
-	Audience string
-	Expires  float64
-	IssuedAt float64
-	Subject  string
-	UID      string
-	Claims   map[string]any
-	Products []string
-	Role     string
-	Groups   []string
+// TrustedIssuer is an audience, i.e. a Firebase project ID, and the issuer expected for it.
+// If Issuer is empty it is derived from the audience, and if Algorithms is empty the validator's algorithms are used
+type TrustedIssuer struct {
+	Audience   string
+	Issuer     string
+	Algorithms []string
 }
 
 type ValidateTokenRequest struct {
 	Token    string
 	Audience string
+	// Trusted accepts tokens for any of several projects. If set, Audience is ignored
+	Trusted []TrustedIssuer
+
+	// RequireEmailVerified rejects tokens without email_verified=true
+	RequireEmailVerified bool
+	// AllowedSignInProviders restricts firebase.sign_in_provider, e.g. to []string{"password", "google.com"}. Empty allows any provider
+	AllowedSignInProviders []string
+	// MaxAuthAge rejects tokens where the user signed in longer ago than this. Zero disables the check
+	MaxAuthAge time.Duration
+	// RequiredClaims must be present in the token with the given value. A nil value only requires the claim to be present
+	RequiredClaims map[string]any
 }
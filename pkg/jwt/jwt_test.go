@@ -0,0 +1,213 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestAuthTokenFields(t *testing.T) {
+	s := jwttest.NewServer(t)
+	v := s.Validator()
+
+	tests := []struct {
+		name       string
+		claims     map[string]any
+		check      func(t *testing.T, token jwt.AuthToken)
+		wantClaims map[string]any
+	}{
+		{
+			name: "password sign in with profile",
+			claims: map[string]any{
+				"email":          "user@example.com",
+				"email_verified": true,
+				"name":           "Some User",
+				"picture":        "https://example.com/user.png",
+				"role":           "admin",
+				"groups":         []string{"ops"},
+				"products":       []string{"rides"},
+				"firebase": map[string]any{
+					"sign_in_provider": "password",
+					"identities":       map[string]any{"email": []string{"user@example.com"}},
+				},
+			},
+			check: func(t *testing.T, token jwt.AuthToken) {
+				want := jwt.FirebaseInfo{
+					SignInProvider: "password",
+					Identities:     map[string][]string{"email": {"user@example.com"}},
+				}
+				if !reflect.DeepEqual(token.Firebase, want) {
+					t.Errorf("firebase: expected %+v, got %+v", want, token.Firebase)
+				}
+				if token.Email != "user@example.com" || !token.EmailVerified || token.Name != "Some User" || token.Picture != "https://example.com/user.png" {
+					t.Errorf("unexpected profile fields: %+v", token)
+				}
+				if token.Role != "admin" || !reflect.DeepEqual(token.Groups, []string{"ops"}) || !reflect.DeepEqual(token.Products, []string{"rides"}) {
+					t.Errorf("unexpected role, groups or products: %+v", token)
+				}
+			},
+			wantClaims: map[string]any{},
+		},
+		{
+			name: "phone second factor in tenant",
+			claims: map[string]any{
+				"email":          "user@example.com",
+				"email_verified": false,
+				"phone_number":   "+4512345678",
+				"firebase": map[string]any{
+					"sign_in_provider":         "google.com",
+					"sign_in_second_factor":    "phone",
+					"second_factor_identifier": "factor-1",
+					"tenant":                   "tenant-1",
+					"identities": map[string]any{
+						"google.com": []string{"1234"},
+						"phone":      []string{"+4512345678"},
+					},
+				},
+			},
+			check: func(t *testing.T, token jwt.AuthToken) {
+				want := jwt.FirebaseInfo{
+					SignInProvider:         "google.com",
+					SignInSecondFactor:     "phone",
+					SecondFactorIdentifier: "factor-1",
+					Tenant:                 "tenant-1",
+					Identities: map[string][]string{
+						"google.com": {"1234"},
+						"phone":      {"+4512345678"},
+					},
+				}
+				if !reflect.DeepEqual(token.Firebase, want) {
+					t.Errorf("firebase: expected %+v, got %+v", want, token.Firebase)
+				}
+				if token.EmailVerified || token.PhoneNumber != "+4512345678" {
+					t.Errorf("unexpected email_verified or phone_number: %+v", token)
+				}
+			},
+			wantClaims: map[string]any{},
+		},
+		{
+			name: "custom claims are kept in Claims",
+			claims: map[string]any{
+				"tier":    "gold",
+				"seats":   4,
+				"flags":   map[string]any{"beta": true},
+				"aliases": []string{"a", "b"},
+			},
+			check: func(t *testing.T, token jwt.AuthToken) {
+				if token.UID != "user" || token.Subject != "user" || token.ProjectID != s.ProjectID {
+					t.Errorf("unexpected uid, subject or project: %+v", token)
+				}
+			},
+			wantClaims: map[string]any{
+				"tier":    "gold",
+				"seats":   float64(4),
+				"flags":   map[string]any{"beta": true},
+				"aliases": []any{"a", "b"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := v.Validate(context.Background(), jwt.ValidateTokenRequest{Token: s.Mint("user", tt.claims), Audience: s.ProjectID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.check(t, token)
+			if !reflect.DeepEqual(token.Claims, tt.wantClaims) {
+				t.Errorf("claims: expected %v, got %v", tt.wantClaims, token.Claims)
+			}
+		})
+	}
+}
+
+func TestAuthTokenListClaimsAreLenient(t *testing.T) {
+	s := jwttest.NewServer(t)
+	v := s.Validator()
+
+	tests := []struct {
+		name         string
+		claims       map[string]any
+		wantGroups   []string
+		wantProducts []string
+	}{
+		{"lists of strings", map[string]any{"groups": []string{"ops"}, "products": []string{"rides"}}, []string{"ops"}, []string{"rides"}},
+		{"single strings", map[string]any{"groups": "ops", "products": "rides"}, []string{"ops"}, []string{"rides"}},
+		{"entries that are not strings", map[string]any{"groups": []any{"ops", 2, nil}}, []string{"ops", "", ""}, nil},
+		{"not lists", map[string]any{"groups": 2, "products": map[string]any{"rides": true}}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := v.Validate(context.Background(), jwt.ValidateTokenRequest{Token: s.Mint("user", tt.claims), Audience: s.ProjectID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(token.Groups, tt.wantGroups) {
+				t.Errorf("groups: expected %#v, got %#v", tt.wantGroups, token.Groups)
+			}
+			if !reflect.DeepEqual(token.Products, tt.wantProducts) {
+				t.Errorf("products: expected %#v, got %#v", tt.wantProducts, token.Products)
+			}
+		})
+	}
+}
+
+func TestValidateInto(t *testing.T) {
+	s := jwttest.NewServer(t)
+	v := s.Validator()
+	type claims struct {
+		UID   string   `json:"user_id"`
+		Tier  string   `json:"tier"`
+		Seats int      `json:"seats"`
+		Tags  []string `json:"tags"`
+	}
+
+	got, err := jwt.ValidateInto[claims](context.Background(), v, jwt.ValidateTokenRequest{
+		Token:    s.Mint("user", map[string]any{"tier": "gold", "seats": 4, "tags": []string{"a"}}),
+		Audience: s.ProjectID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := claims{UID: "user", Tier: "gold", Seats: 4, Tags: []string{"a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	// a caller's own types are decoded strictly
+	_, err = jwt.ValidateInto[claims](context.Background(), v, jwt.ValidateTokenRequest{
+		Token:    s.Mint("user", map[string]any{"tags": "a"}),
+		Audience: s.ProjectID,
+	})
+	if !errors.Is(err, jwt.ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestAllClaimsOfTokenBuiltInCode(t *testing.T) {
+	tests := []struct {
+		name  string
+		token jwt.AuthToken
+		want  map[string]any
+	}{
+		{"zero values are left out", jwt.AuthToken{UID: "user"}, map[string]any{"user_id": "user"}},
+		{"firebase info", jwt.AuthToken{UID: "user", Firebase: jwt.FirebaseInfo{SignInProvider: "password"}}, map[string]any{
+			"user_id":  "user",
+			"firebase": map[string]any{"sign_in_provider": "password"},
+		}},
+		{"claims are kept as they are", jwt.AuthToken{Role: "admin", Claims: map[string]any{"flags": map[string]any{}}}, map[string]any{
+			"role":  "admin",
+			"flags": map[string]any{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.token.AllClaims(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
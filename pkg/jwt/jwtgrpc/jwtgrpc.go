@@ -0,0 +1,127 @@
+// Package jwtgrpc validates tokens in gRPC servers and attaches them to gRPC client calls
+package jwtgrpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const authorizationKey = "authorization"
+
+type Options struct {
+	// Request is the template for every validation, e.g. the audience and policies. Its Token is taken from the authorization metadata
+	Request jwt.ValidateTokenRequest
+	// Skip returns true for methods that do not require a token, e.g. "/grpc.health.v1.Health/Check"
+	Skip func(fullMethod string) bool
+}
+
+// UnaryServerInterceptor validates the bearer token in the authorization metadata and stores the AuthToken in the context, see jwt.FromContext
+func UnaryServerInterceptor(v *jwt.Validator, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if opts.Skip != nil && opts.Skip(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, v, opts)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor validates the bearer token in the authorization metadata and stores the AuthToken in the stream context, see jwt.FromContext
+func StreamServerInterceptor(v *jwt.Validator, opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if opts.Skip != nil && opts.Skip(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticate(ss.Context(), v, opts)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticate(ctx context.Context, v *jwt.Validator, opts Options) (context.Context, error) {
+	request := opts.Request
+	request.Token = bearerToken(ctx)
+	if request.Token == "" {
+		return nil, status.Error(codes.Unauthenticated, jwt.ErrNoToken.Error())
+	}
+	token, err := v.Validate(ctx, request)
+	if err != nil {
+		return nil, StatusFromError(err).Err()
+	}
+	return jwt.NewContext(ctx, token), nil
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get(authorizationKey) {
+		scheme, token, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
+
+// StatusFromError maps a validation error to codes.Unavailable if the token could not be checked, and codes.Unauthenticated otherwise
+func StatusFromError(err error) *status.Status {
+	if errors.Is(err, jwt.ErrKeysUnavailable) || errors.Is(err, jwt.ErrRevocationUnavailable) {
+		return status.New(codes.Unavailable, err.Error())
+	}
+	return status.New(codes.Unauthenticated, err.Error())
+}
+
+// TokenSource returns the token to send with a call, e.g. a freshly refreshed Firebase ID token
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenSource that always returns token
+func StaticToken(token string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// PerRPCCredentials sends a bearer token from a TokenSource with every call. Use it with grpc.WithPerRPCCredentials
+type PerRPCCredentials struct {
+	Source TokenSource
+	// AllowInsecure allows sending the token over connections without transport security, e.g. in local development
+	AllowInsecure bool
+}
+
+func (c PerRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := c.Source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{authorizationKey: "Bearer " + token}, nil
+}
+
+func (c PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
+
+var _ credentials.PerRPCCredentials = PerRPCCredentials{}
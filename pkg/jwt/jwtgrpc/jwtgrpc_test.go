@@ -0,0 +1,122 @@
+package jwtgrpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwtgrpc"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestServerInterceptors(t *testing.T) {
+	s := jwttest.NewServer(t)
+	opts := jwtgrpc.Options{
+		Request: jwt.ValidateTokenRequest{Audience: s.ProjectID},
+		Skip:    func(fullMethod string) bool { return fullMethod == "/grpc.health.v1.Health/Check" },
+	}
+	unary := jwtgrpc.UnaryServerInterceptor(s.Validator(), opts)
+	stream := jwtgrpc.StreamServerInterceptor(s.Validator(), opts)
+
+	tests := []struct {
+		name     string
+		method   string
+		md       metadata.MD
+		wantCode codes.Code
+		wantUID  string
+	}{
+		{"missing token", "/svc/Method", metadata.MD{}, codes.Unauthenticated, ""},
+		{"not a bearer token", "/svc/Method", metadata.Pairs("authorization", "Basic abc"), codes.Unauthenticated, ""},
+		{"invalid token", "/svc/Method", metadata.Pairs("authorization", "Bearer garbage"), codes.Unauthenticated, ""},
+		{"valid token", "/svc/Method", metadata.Pairs("authorization", "Bearer "+s.Mint("user", nil)), codes.OK, "user"},
+		{"skipped method", "/grpc.health.v1.Health/Check", metadata.MD{}, codes.OK, ""},
+	}
+	for _, tt := range tests {
+		ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+		check := func(t *testing.T, handlerCtx context.Context, err error) {
+			t.Helper()
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("expected %v, got %v", tt.wantCode, err)
+			}
+			if tt.wantCode != codes.OK {
+				return
+			}
+			token, ok := jwt.FromContext(handlerCtx)
+			if ok != (tt.wantUID != "") || token.UID != tt.wantUID {
+				t.Errorf("expected uid %q in the context, got %q", tt.wantUID, token.UID)
+			}
+		}
+		t.Run("unary "+tt.name, func(t *testing.T) {
+			var handlerCtx context.Context
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req any) (any, error) {
+				handlerCtx = ctx
+				return nil, nil
+			})
+			check(t, handlerCtx, err)
+		})
+		t.Run("stream "+tt.name, func(t *testing.T) {
+			var handlerCtx context.Context
+			err := stream(nil, &serverStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: tt.method}, func(srv any, ss grpc.ServerStream) error {
+				handlerCtx = ss.Context()
+				return nil
+			})
+			check(t, handlerCtx, err)
+		})
+	}
+}
+
+func TestStatusFromError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("%w: fetch failed", jwt.ErrKeysUnavailable), codes.Unavailable},
+		{fmt.Errorf("%w: lookup failed", jwt.ErrRevocationUnavailable), codes.Unavailable},
+		{&jwt.ValidationError{Kind: jwt.ErrExpired}, codes.Unauthenticated},
+		{errors.New("other"), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := jwtgrpc.StatusFromError(tt.err).Code(); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPerRPCCredentials(t *testing.T) {
+	creds := jwtgrpc.PerRPCCredentials{Source: jwtgrpc.StaticToken("token")}
+	md, err := creds.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := md["authorization"]; got != "Bearer token" {
+		t.Errorf("expected a bearer token, got %q", got)
+	}
+	if !creds.RequireTransportSecurity() {
+		t.Error("expected transport security to be required")
+	}
+	if (jwtgrpc.PerRPCCredentials{AllowInsecure: true}).RequireTransportSecurity() {
+		t.Error("expected AllowInsecure to not require transport security")
+	}
+
+	failing := jwtgrpc.PerRPCCredentials{Source: func(ctx context.Context) (string, error) { return "", errors.New("refresh failed") }}
+	if _, err := failing.GetRequestMetadata(context.Background()); err == nil {
+		t.Error("expected the token source error")
+	}
+}
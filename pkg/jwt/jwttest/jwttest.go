@@ -0,0 +1,209 @@
+// Package jwttest serves signing keys and mints tokens that pkg/jwt accepts, for use in tests
+package jwttest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+const DefaultProjectID = "test-project"
+const DefaultKeyID = "test-key"
+
+// Server serves a generated RSA key as a self-signed certificate in the Google x509 metadata format at /x509,
+// as a JWKS at /jwks and as an OpenID Connect provider at /.well-known/openid-configuration
+type Server struct {
+	*httptest.Server
+
+	Key         *rsa.PrivateKey
+	KeyID       string
+	Certificate string
+	ProjectID   string
+
+	tb testing.TB
+}
+
+// NewServer starts a Server which is closed when the test finishes
+func NewServer(tb testing.TB) *Server {
+	tb.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		tb.Fatalf("error generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jwttest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		tb.Fatalf("error creating certificate: %v", err)
+	}
+	s := &Server{
+		Key:         key,
+		KeyID:       DefaultKeyID,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		ProjectID:   DefaultProjectID,
+		tb:          tb,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/x509", s.handleX509)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleOpenIDConfiguration)
+	s.Server = httptest.NewServer(mux)
+	tb.Cleanup(s.Close)
+	return s
+}
+
+func (s *Server) handleX509(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{s.KeyID: s.Certificate})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": s.KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(s.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.Key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) handleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jwt.OIDCConfiguration{
+		Issuer:                           s.URL,
+		JWKSURI:                          s.JWKSURL(),
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+	})
+}
+
+// X509URL is the url of the keys in the Google x509 metadata format
+func (s *Server) X509URL() string {
+	return s.URL + "/x509"
+}
+
+// JWKSURL is the url of the keys as a JWKS
+func (s *Server) JWKSURL() string {
+	return s.URL + "/jwks"
+}
+
+// Validator returns a Validator that fetches ID token and session cookie keys from the server
+func (s *Server) Validator(opts ...jwt.ValidatorOption) *jwt.Validator {
+	defaults := []jwt.ValidatorOption{
+		jwt.WithKeyRetreiver(jwt.NewGoogleKeyRetreiver(jwt.WithKeysURL(s.X509URL()))),
+		jwt.WithSessionCookieKeyRetreiver(jwt.NewSessionCookieKeyRetreiver(jwt.WithKeysURL(s.X509URL()))),
+	}
+	return jwt.NewValidator(append(defaults, opts...)...)
+}
+
+type mintOptions struct {
+	kid           string
+	now           time.Time
+	expiresIn     time.Duration
+	sessionCookie bool
+	method        gojwt.SigningMethod
+}
+
+type MintOption func(*mintOptions)
+
+// WithKeyID sets the kid header, e.g. to a kid the server does not know
+func WithKeyID(kid string) MintOption {
+	return func(o *mintOptions) {
+		o.kid = kid
+	}
+}
+
+// WithIssuedAt sets iat and auth_time. Defaults to now
+func WithIssuedAt(t time.Time) MintOption {
+	return func(o *mintOptions) {
+		o.now = t
+	}
+}
+
+// WithExpiresIn sets exp relative to iat. Defaults to 1 hour, negative values mint expired tokens
+func WithExpiresIn(d time.Duration) MintOption {
+	return func(o *mintOptions) {
+		o.expiresIn = d
+	}
+}
+
+// AsSessionCookie mints a session cookie rather than an ID token, i.e. with the session cookie issuer
+func AsSessionCookie() MintOption {
+	return func(o *mintOptions) {
+		o.sessionCookie = true
+	}
+}
+
+// WithSigningMethod sets the alg of the token. Defaults to RS256, the key only supports RS and PS algorithms.
+// gojwt.SigningMethodNone mints an unsigned token like those issued by the Firebase Auth emulator
+func WithSigningMethod(method gojwt.SigningMethod) MintOption {
+	return func(o *mintOptions) {
+		o.method = method
+	}
+}
+
+// Mint signs a Firebase style token for uid. claims are added to, or override, the default claims
+func (s *Server) Mint(uid string, claims map[string]any, opts ...MintOption) string {
+	s.tb.Helper()
+	o := mintOptions{
+		kid:       s.KeyID,
+		now:       time.Now(),
+		expiresIn: time.Hour,
+		method:    gojwt.SigningMethodRS256,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	issuer := "https://securetoken.google.com/" + s.ProjectID
+	if o.sessionCookie {
+		issuer = "https://session.firebase.google.com/" + s.ProjectID
+	}
+	mapClaims := gojwt.MapClaims{
+		"iss":       issuer,
+		"aud":       s.ProjectID,
+		"sub":       uid,
+		"user_id":   uid,
+		"auth_time": o.now.Unix(),
+		"iat":       o.now.Unix(),
+		"exp":       o.now.Add(o.expiresIn).Unix(),
+		"firebase": map[string]any{
+			"sign_in_provider": "custom",
+			"identities":       map[string]any{},
+		},
+	}
+	for k, v := range claims {
+		mapClaims[k] = v
+	}
+	token := gojwt.NewWithClaims(o.method, mapClaims)
+	token.Header["kid"] = o.kid
+	var key any = s.Key
+	if o.method == gojwt.SigningMethodNone {
+		key = gojwt.UnsafeAllowNoneSignatureType
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		s.tb.Fatalf("error signing token: %v", err)
+	}
+	return signed
+}
@@ -0,0 +1,97 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// maxCachedKeysAge bounds how long keys loaded from a cache file are trusted,
+// whatever expiry the file claims
+const maxCachedKeysAge = 24 * time.Hour
+
+// keyCacheFile is the on-disk representation of a key snapshot
+type keyCacheFile struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Document  []byte    `json:"document"`
+}
+
+func (ks *remoteKeySet) loadCacheFile() (*keySnapshot, error) {
+	f, err := os.Open(ks.cacheFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	// anyone who can write the cache file can make us trust their keys
+	err = checkCacheFilePermissions(info)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	cached := keyCacheFile{}
+	err = json.Unmarshal(data, &cached)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key cache file: %w", err)
+	}
+	if cached.URL != ks.url {
+		return nil, fmt.Errorf("key cache file is for %v, not %v", cached.URL, ks.url)
+	}
+	keys, err := ks.decode(cached.Document)
+	if err != nil {
+		return nil, err
+	}
+	return &keySnapshot{
+		keys:      keys,
+		expiresAt: minTime(cached.ExpiresAt, ks.now().Add(maxCachedKeysAge)),
+		raw:       cached.Document,
+	}, nil
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// writeCacheFile writes the snapshot to a temporary file and renames it into place,
+// so a crash mid-write never leaves a truncated cache file behind
+func (ks *remoteKeySet) writeCacheFile(snapshot *keySnapshot) error {
+	data, err := json.Marshal(keyCacheFile{
+		URL:       ks.url,
+		ExpiresAt: snapshot.expiresAt,
+		Document:  snapshot.raw,
+	})
+	if err != nil {
+		return fmt.Errorf("error encoding key cache file: %w", err)
+	}
+	dir := filepath.Dir(ks.cacheFile)
+	f, err := os.CreateTemp(dir, filepath.Base(ks.cacheFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating key cache file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing key cache file: %w", err)
+	}
+	err = os.Rename(f.Name(), ks.cacheFile)
+	if err != nil {
+		return fmt.Errorf("error renaming key cache file: %w", err)
+	}
+	return nil
+}
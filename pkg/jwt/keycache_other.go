@@ -0,0 +1,10 @@
+//go:build !unix
+
+package jwt
+
+import "os"
+
+// checkCacheFilePermissions is a no-op where file ownership and modes are not available
+func checkCacheFilePermissions(info os.FileInfo) error {
+	return nil
+}
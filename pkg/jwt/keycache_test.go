@@ -0,0 +1,97 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyCacheFileIsLoadedUntilExpiry(t *testing.T) {
+	server := newKeyServer(t)
+	cacheFile := filepath.Join(t.TempDir(), "keys.json")
+	start := time.Now()
+
+	ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile), WithKeysClock(func() time.Time { return start }))
+	if _, err := ks.GetKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Stats().LastPersistError; err != nil {
+		t.Fatalf("error writing cache file: %v", err)
+	}
+	expiresAt := ks.Stats().ExpiresAt
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		wantFetches int64
+	}{
+		{"before expiry", start.Add(99 * time.Second), 1},
+		// expired keys are only served for the grace period, and the refresh does not wait for them
+		{"after expiry and grace period", start.Add(101*time.Second + time.Hour), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.fetches.Store(1)
+			loaded := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile), WithKeysClock(func() time.Time { return tt.now }))
+			if got := loaded.Stats().ExpiresAt; !got.Equal(expiresAt) {
+				t.Errorf("expected the cached expiry %v, got %v", expiresAt, got)
+			}
+			keys, err := loaded.GetKeys(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if keys["kid1"] == nil {
+				t.Error("kid1 missing")
+			}
+			if n := server.fetches.Load(); n != tt.wantFetches {
+				t.Errorf("expected %v fetches, got %v", tt.wantFetches, n)
+			}
+		})
+	}
+}
+
+func TestKeyCacheFileForOtherURLIsIgnored(t *testing.T) {
+	server := newKeyServer(t)
+	cacheFile := filepath.Join(t.TempDir(), "keys.json")
+	ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile))
+	if _, err := ks.GetKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newRemoteKeySet(server.URL+"/other", parseJWKS, WithKeysCacheFile(cacheFile))
+	if stats := other.Stats(); stats.Keys != 0 {
+		t.Errorf("expected no keys loaded from a cache file for another url, got %v", stats.Keys)
+	}
+}
+
+func TestKeyCacheFileExpiryIsCapped(t *testing.T) {
+	server := newKeyServer(t)
+	cacheFile := filepath.Join(t.TempDir(), "keys.json")
+	now := time.Now()
+	ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile))
+	if _, err := ks.GetKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := keyCacheFile{}
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatal(err)
+	}
+	cached.ExpiresAt = now.Add(365 * 24 * time.Hour)
+	data, _ = json.Marshal(cached)
+	if err := os.WriteFile(cacheFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile), WithKeysClock(func() time.Time { return now }))
+	if got, want := loaded.Stats().ExpiresAt, now.Add(maxCachedKeysAge); !got.Equal(want) {
+		t.Errorf("expected the expiry to be capped at %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package jwt
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkCacheFilePermissions rejects cache files that are not owned by the current user,
+// or that can be written by the group or others
+func checkCacheFilePermissions(info os.FileInfo) error {
+	if info.Mode().Perm()&0o022 != 0 {
+		return fmt.Errorf("key cache file is writable by group or others: %v", info.Mode().Perm())
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Geteuid() {
+		return fmt.Errorf("key cache file is owned by uid %v, not %v", stat.Uid, os.Geteuid())
+	}
+	return nil
+}
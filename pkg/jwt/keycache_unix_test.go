@@ -0,0 +1,53 @@
+//go:build unix
+
+package jwt
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyCacheFilePermissions(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(t *testing.T, path string)
+		wantKeys bool
+	}{
+		{"owned and private", func(t *testing.T, path string) {}, true},
+		{"group writable", func(t *testing.T, path string) { chmod(t, path, 0o620) }, false},
+		{"world writable", func(t *testing.T, path string) { chmod(t, path, 0o602) }, false},
+		{"owned by another user", func(t *testing.T, path string) {
+			if os.Geteuid() != 0 {
+				t.Skip("changing the owner requires root")
+			}
+			if err := os.Chown(path, 65534, 65534); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newKeyServer(t)
+			cacheFile := filepath.Join(t.TempDir(), "keys.json")
+			ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile))
+			if _, err := ks.GetKeys(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			tt.prepare(t, cacheFile)
+
+			loaded := newRemoteKeySet(server.URL, parseJWKS, WithKeysCacheFile(cacheFile))
+			if got := loaded.Stats().Keys > 0; got != tt.wantKeys {
+				t.Errorf("expected keys loaded to be %v, got %v", tt.wantKeys, got)
+			}
+		})
+	}
+}
+
+func chmod(t *testing.T, path string, mode os.FileMode) {
+	t.Helper()
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+}
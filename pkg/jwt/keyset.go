@@ -0,0 +1,364 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// KeyRefresher is implemented by key retreivers that can refetch their keys on demand,
+// e.g. when a token is signed with a kid that is not in the cached key set
+type KeyRefresher interface {
+	RefreshKeys(context.Context) (map[string]crypto.PublicKey, error)
+}
+
+// KeyStats describes the state of a cached key set
+type KeyStats struct {
+	Keys             int
+	ExpiresAt        time.Time
+	LastRefresh      time.Time
+	LastRefreshError error
+	RefreshSuccesses uint64
+	RefreshFailures  uint64
+	LastPersistError error
+}
+
+// remoteKeySet fetches a key document from a url and caches it for as long as the Cache-Control header allows.
+// Readers load an immutable snapshot without locking, and concurrent refreshes share a single in-flight fetch.
+// Once expired, keys are served for a grace period while a refresh runs in the background
+type remoteKeySet struct {
+	url                string
+	httpClient         *http.Client
+	now                func() time.Time
+	fetchTimeout       time.Duration
+	staleGracePeriod   time.Duration
+	refreshAhead       time.Duration
+	minRefreshInterval time.Duration
+	cacheFile          string
+	defaultMaxAge      time.Duration
+	decode             func([]byte) (map[string]crypto.PublicKey, error)
+	metrics            *Metrics
+	metricsName        string
+
+	cache atomic.Pointer[keySnapshot]
+
+	refreshSuccesses atomic.Uint64
+	refreshFailures  atomic.Uint64
+
+	mu               sync.Mutex
+	inflight         *keyFetch
+	lastFetchStarted time.Time
+	lastRefresh      time.Time
+	lastRefreshErr   error
+	lastPersistErr   error
+}
+
+// keySnapshot is a parsed key set together with its expiry and the document it was parsed from.
+// It is never modified after creation
+type keySnapshot struct {
+	keys      map[string]crypto.PublicKey
+	expiresAt time.Time
+	raw       []byte
+}
+
+func (s *keySnapshot) valid(now time.Time) bool {
+	return s != nil && len(s.keys) > 0 && now.Before(s.expiresAt)
+}
+
+// usable reports whether the keys may still be served, possibly stale, within the grace period
+func (s *keySnapshot) usable(now time.Time, grace time.Duration) bool {
+	return s != nil && len(s.keys) > 0 && now.Before(s.expiresAt.Add(grace))
+}
+
+// keyFetch is a fetch in progress. snapshot and err are set before done is closed
+type keyFetch struct {
+	done     chan struct{}
+	snapshot *keySnapshot
+	err      error
+}
+
+type KeyRetreiverOption func(*remoteKeySet)
+
+// WithKeysURL overrides the endpoint the keys are fetched from
+func WithKeysURL(url string) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.url = url
+	}
+}
+
+// WithKeysHTTPClient sets the http client used to fetch keys
+func WithKeysHTTPClient(client *http.Client) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.httpClient = client
+	}
+}
+
+// WithKeysClock sets the time source used for cache expiry
+func WithKeysClock(now func() time.Time) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.now = now
+	}
+}
+
+// WithKeysFetchTimeout bounds how long a single fetch of the keys may take. Defaults to 30 seconds
+func WithKeysFetchTimeout(timeout time.Duration) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.fetchTimeout = timeout
+	}
+}
+
+// WithKeysStaleGracePeriod sets how long expired keys keep being served when they cannot be refreshed. Defaults to 1 hour
+func WithKeysStaleGracePeriod(grace time.Duration) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.staleGracePeriod = grace
+	}
+}
+
+// WithKeysRefreshAhead sets how long before expiry the background refresher renews the keys. Defaults to 5 minutes
+func WithKeysRefreshAhead(d time.Duration) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.refreshAhead = d
+	}
+}
+
+// minRefreshIntervalFloor keeps Start from retrying failed fetches in a tight loop
+const minRefreshIntervalFloor = time.Second
+
+// WithKeysMinRefreshInterval limits how often keys are refetched on demand or retried after a failure.
+// Defaults to 30 seconds, and cannot be less than 1 second
+func WithKeysMinRefreshInterval(d time.Duration) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.minRefreshInterval = max(d, minRefreshIntervalFloor)
+	}
+}
+
+// WithKeysCacheFile persists fetched keys to path and loads them from there on startup,
+// so that keys which have not expired can be used without a fetch after a restart.
+// The file is ignored unless it is owned by the current user and not writable by anyone else
+func WithKeysCacheFile(path string) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.cacheFile = path
+	}
+}
+
+// WithKeysDefaultMaxAge sets how long keys are cached when the response has no Cache-Control max-age.
+// Defaults to 1 hour for JWKS key retreivers. Google's x509 key retreivers require max-age unless this is set
+func WithKeysDefaultMaxAge(d time.Duration) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.defaultMaxAge = d
+	}
+}
+
+func newRemoteKeySet(url string, decode func([]byte) (map[string]crypto.PublicKey, error), opts ...KeyRetreiverOption) *remoteKeySet {
+	ks := &remoteKeySet{
+		url:                url,
+		httpClient:         http.DefaultClient,
+		now:                time.Now,
+		fetchTimeout:       30 * time.Second,
+		staleGracePeriod:   time.Hour,
+		refreshAhead:       5 * time.Minute,
+		minRefreshInterval: 30 * time.Second,
+		decode:             decode,
+	}
+	for _, opt := range opts {
+		opt(ks)
+	}
+	if ks.cacheFile != "" {
+		// a missing or unreadable cache file just means the keys are fetched
+		if snapshot, err := ks.loadCacheFile(); err == nil {
+			ks.cache.Store(snapshot)
+		}
+	}
+	return ks
+}
+
+func (ks *remoteKeySet) GetKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	now := ks.now()
+	cache := ks.cache.Load()
+	if cache.valid(now) {
+		return cache.keys, nil
+	}
+	if cache.usable(now, ks.staleGracePeriod) {
+		// stale while revalidate
+		ks.startFetch(ctx, false)
+		return cache.keys, nil
+	}
+	snapshot, err := ks.refresh(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.keys, nil
+}
+
+// RefreshKeys refetches the keys, unless a fetch was started within the minimum refresh interval,
+// in which case the current keys are returned
+func (ks *remoteKeySet) RefreshKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	snapshot, err := ks.refresh(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.keys, nil
+}
+
+// Start refreshes the keys in the background shortly before they expire, until ctx is cancelled
+func (ks *remoteKeySet) Start(ctx context.Context) {
+	// the first fetch happens right away, failed fetches are retried after the minimum refresh interval
+	wait := time.Duration(0)
+	for {
+		if cache := ks.cache.Load(); cache.valid(ks.now()) {
+			wait = max(cache.expiresAt.Sub(ks.now())-ks.refreshAhead, ks.minRefreshInterval)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		_, _ = ks.refresh(ctx, true)
+		wait = ks.minRefreshInterval
+	}
+}
+
+// Stats returns the state of the cached keys and the outcome of previous refreshes
+func (ks *remoteKeySet) Stats() KeyStats {
+	stats := KeyStats{
+		RefreshSuccesses: ks.refreshSuccesses.Load(),
+		RefreshFailures:  ks.refreshFailures.Load(),
+	}
+	if cache := ks.cache.Load(); cache != nil {
+		stats.Keys = len(cache.keys)
+		stats.ExpiresAt = cache.expiresAt
+	}
+	ks.mu.Lock()
+	stats.LastRefresh = ks.lastRefresh
+	stats.LastRefreshError = ks.lastRefreshErr
+	stats.LastPersistError = ks.lastPersistErr
+	ks.mu.Unlock()
+	return stats
+}
+
+// refresh fetches the keys, joining a fetch that is already in flight if there is one.
+// Unless forced, cached keys that are still valid are returned without fetching
+func (ks *remoteKeySet) refresh(ctx context.Context, force bool) (*keySnapshot, error) {
+	call, cache := ks.startFetch(ctx, force)
+	if call == nil {
+		return cache, nil
+	}
+	select {
+	case <-call.done:
+		if call.err != nil && cache.usable(ks.now(), ks.staleGracePeriod) {
+			return cache, nil
+		}
+		return call.snapshot, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startFetch starts a fetch, or returns the one in flight. If no fetch is needed it returns nil and the cached keys.
+// The fetch itself is detached from ctx so a cancelled caller does not fail the other waiters
+func (ks *remoteKeySet) startFetch(ctx context.Context, force bool) (*keyFetch, *keySnapshot) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	now := ks.now()
+	cache := ks.cache.Load()
+	if ks.inflight != nil {
+		return ks.inflight, cache
+	}
+	if !force && cache.valid(now) {
+		return nil, cache
+	}
+	if cache.usable(now, ks.staleGracePeriod) && now.Sub(ks.lastFetchStarted) < ks.minRefreshInterval {
+		return nil, cache
+	}
+	call := &keyFetch{done: make(chan struct{})}
+	ks.inflight = call
+	ks.lastFetchStarted = now
+	go ks.runFetch(context.WithoutCancel(ctx), call)
+	return call, cache
+}
+
+func (ks *remoteKeySet) runFetch(ctx context.Context, call *keyFetch) {
+	ctx, cancel := context.WithTimeout(ctx, ks.fetchTimeout)
+	defer cancel()
+	ctx, span := tracer.Start(ctx, "jwt.FetchKeys", trace.WithAttributes(attribute.String("url.full", ks.url)))
+	snapshot, err := ks.fetch(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "key fetch failed")
+	}
+	span.End()
+	ks.metrics.observeKeyFetch(ks.metricsName, err)
+	var persistErr error
+	if err == nil {
+		ks.cache.Store(snapshot)
+		ks.refreshSuccesses.Add(1)
+		if ks.cacheFile != "" {
+			persistErr = ks.writeCacheFile(snapshot)
+		}
+	} else {
+		ks.refreshFailures.Add(1)
+	}
+	ks.mu.Lock()
+	if ks.cacheFile != "" && err == nil {
+		ks.lastPersistErr = persistErr
+	}
+	ks.inflight = nil
+	ks.lastRefresh = ks.now()
+	ks.lastRefreshErr = err
+	ks.mu.Unlock()
+	call.snapshot = snapshot
+	call.err = err
+	close(call.done)
+}
+
+func (ks *remoteKeySet) fetch(ctx context.Context) (*keySnapshot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := ks.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("got non success code from key endpoint: %v", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keys: %w", err)
+	}
+	keys, err := ks.decode(body)
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := getMaxAge(resp)
+	if err != nil && ks.defaultMaxAge > 0 {
+		// many OIDC providers send no-cache or no max-age at all
+		maxAge, err = int(ks.defaultMaxAge.Seconds()), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting max age: %w", err)
+	}
+	age, err := getAge(resp)
+	if err != nil {
+		return nil, fmt.Errorf("error getting age: %w", err)
+	}
+	cacheExpiresAfterSeconds := maxAge - age
+	return &keySnapshot{
+		keys:      keys,
+		expiresAt: ks.now().UTC().Add(time.Second * time.Duration(cacheExpiresAfterSeconds)),
+		raw:       body,
+	}, nil
+}
@@ -0,0 +1,362 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+// keyServer serves a JWKS with a single RSA key and counts the requests it receives
+type keyServer struct {
+	*httptest.Server
+	fetches      atomic.Int64
+	cacheControl string
+	// failing makes the server respond with 500
+	failing atomic.Bool
+	// handler blocks on release, if set, after signalling on received
+	received chan struct{}
+	release  chan struct{}
+}
+
+func newKeyServer(t *testing.T) *keyServer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "kid1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ks := &keyServer{cacheControl: "public, max-age=100"}
+	ks.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ks.fetches.Add(1)
+		if ks.release != nil {
+			ks.received <- struct{}{}
+			<-ks.release
+		}
+		if ks.failing.Load() {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		if ks.cacheControl != "" {
+			w.Header().Set("Cache-Control", ks.cacheControl)
+		}
+		_, _ = w.Write(doc)
+	}))
+	t.Cleanup(ks.Close)
+	return ks
+}
+
+// block makes requests wait until the returned function is called
+func (ks *keyServer) block() func() {
+	ks.received = make(chan struct{}, 100)
+	ks.release = make(chan struct{})
+	return sync.OnceFunc(func() { close(ks.release) })
+}
+
+func TestRemoteKeySetConcurrentBurstFetchesOnce(t *testing.T) {
+	server := newKeyServer(t)
+	release := server.block()
+	defer release()
+	ks := newRemoteKeySet(server.URL, parseJWKS)
+
+	const callers = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var keys map[string]crypto.PublicKey
+			var err error
+			if i%2 == 0 {
+				keys, err = ks.GetKeys(context.Background())
+			} else {
+				keys, err = ks.RefreshKeys(context.Background())
+			}
+			if err == nil && keys["kid1"] == nil {
+				err = errors.New("kid1 missing")
+			}
+			errs <- err
+		}()
+	}
+	<-server.received
+	// give the other callers time to join the fetch in flight
+	time.Sleep(50 * time.Millisecond)
+	release()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %v", n)
+	}
+
+	// callers arriving after the burst are served from the cache, and forced refreshes are rate limited
+	for range callers {
+		if _, err := ks.GetKeys(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ks.RefreshKeys(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("expected 1 fetch after the burst, got %v", n)
+	}
+}
+
+func TestRemoteKeySetCancelledWaiterDoesNotFailOthers(t *testing.T) {
+	server := newKeyServer(t)
+	release := server.block()
+	defer release()
+	ks := newRemoteKeySet(server.URL, parseJWKS)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error, 1)
+	go func() {
+		_, err := ks.GetKeys(cancelledCtx)
+		cancelledErr <- err
+	}()
+	<-server.received
+
+	const waiters = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, waiters)
+	for range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := ks.GetKeys(context.Background())
+			if err == nil && keys["kid1"] == nil {
+				err = errors.New("kid1 missing")
+			}
+			errs <- err
+		}()
+	}
+
+	cancel()
+	if err := <-cancelledErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to get context.Canceled, got %v", err)
+	}
+	release()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("waiter failed: %v", err)
+		}
+	}
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %v", n)
+	}
+}
+
+func TestRemoteKeySetServesStaleKeysWhileRefreshing(t *testing.T) {
+	server := newKeyServer(t)
+	now := time.Now()
+	var mu sync.Mutex
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysClock(clock))
+	if _, err := ks.GetKeys(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	release := server.block()
+	defer release()
+	mu.Lock()
+	now = now.Add(101 * time.Second)
+	mu.Unlock()
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := ks.GetKeys(context.Background())
+			if err != nil || keys["kid1"] == nil {
+				t.Errorf("expected stale keys, got %v %v", keys, err)
+			}
+		}()
+	}
+	// the stale keys are returned without waiting for the refresh
+	wg.Wait()
+	<-server.received
+	release()
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("expected 2 fetches, got %v", n)
+	}
+}
+
+// fakeClock is a settable time source safe for concurrent use
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func TestRemoteKeySetOutage(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name      string
+		now       time.Time
+		wantStale bool
+	}{
+		{"within grace period", start.Add(101 * time.Second), true},
+		{"end of grace period", start.Add(100*time.Second + time.Hour - time.Second), true},
+		{"after grace period", start.Add(101*time.Second + time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newKeyServer(t)
+			clock := &fakeClock{now: start}
+			ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysClock(clock.Now))
+			if _, err := ks.GetKeys(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			server.failing.Store(true)
+			clock.Set(tt.now)
+			// a forced refresh waits for the failing fetch, and falls back to the last known good keys
+			keys, err := ks.RefreshKeys(context.Background())
+			if tt.wantStale {
+				if err != nil || keys["kid1"] == nil {
+					t.Fatalf("expected stale keys, got %v %v", keys, err)
+				}
+				if keys, err := ks.GetKeys(context.Background()); err != nil || keys["kid1"] == nil {
+					t.Fatalf("expected stale keys from GetKeys, got %v %v", keys, err)
+				}
+			} else {
+				if err == nil {
+					t.Fatalf("expected an error once the grace period has passed, got %v", keys)
+				}
+				if _, err := ks.GetKeys(context.Background()); err == nil {
+					t.Fatal("expected an error from GetKeys once the grace period has passed")
+				}
+			}
+			if stats := ks.Stats(); stats.RefreshFailures == 0 || stats.LastRefreshError == nil {
+				t.Errorf("expected the failed refresh in stats, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestRemoteKeySetStartRefreshesAhead(t *testing.T) {
+	server := newKeyServer(t)
+	server.cacheControl = "public, max-age=3"
+	ks := newRemoteKeySet(server.URL, parseJWKS, WithKeysRefreshAhead(2*time.Second), WithKeysMinRefreshInterval(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ks.Start(ctx)
+
+	waitForFetches := func(n int64, within time.Duration) {
+		t.Helper()
+		deadline := time.Now().Add(within)
+		for server.fetches.Load() < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %v fetches within %v, got %v", n, within, server.fetches.Load())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// the first fetch happens right away
+	waitForFetches(1, time.Second)
+	startedAt := time.Now()
+	// the keys expire after 3 seconds and are renewed 2 seconds ahead of that
+	waitForFetches(2, 2*time.Second)
+	if elapsed := time.Since(startedAt); elapsed < 500*time.Millisecond {
+		t.Errorf("expected the refresh about 1 second after the first fetch, got %v", elapsed)
+	}
+	cancel()
+}
+
+func TestMinRefreshIntervalFloor(t *testing.T) {
+	ks := newRemoteKeySet("http://localhost", parseJWKS, WithKeysMinRefreshInterval(0))
+	if ks.minRefreshInterval != minRefreshIntervalFloor {
+		t.Errorf("expected the minimum refresh interval to be raised to %v, got %v", minRefreshIntervalFloor, ks.minRefreshInterval)
+	}
+}
+
+func TestUnknownKidRefetchesAreRateLimited(t *testing.T) {
+	server := newKeyServer(t)
+	clock := &fakeClock{now: time.Now()}
+	v := NewValidator(
+		WithClock(clock.Now),
+		WithKeyRetreiver(NewJWKSKeyRetreiver(server.URL, WithKeysClock(clock.Now), WithKeysMinRefreshInterval(30*time.Second))),
+	)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, gojwt.MapClaims{
+		"iss": "https://securetoken.google.com/proj", "aud": "proj", "sub": "user",
+		"iat": clock.Now().Unix(), "exp": clock.Now().Add(time.Hour).Unix(), "auth_time": clock.Now().Unix(),
+	})
+	token.Header["kid"] = "unknown"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate := func() {
+		t.Helper()
+		_, err := v.Validate(context.Background(), ValidateTokenRequest{Token: signed, Audience: "proj"})
+		if !errors.Is(err, ErrUnknownKeyID) {
+			t.Fatalf("expected ErrUnknownKeyID, got %v", err)
+		}
+	}
+	for range 10 {
+		validate()
+	}
+	// the initial fetch was started within the minimum refresh interval, so unknown kids do not refetch
+	if n := server.fetches.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %v", n)
+	}
+
+	clock.Set(clock.Now().Add(31 * time.Second))
+	for range 10 {
+		validate()
+	}
+	if n := server.fetches.Load(); n != 2 {
+		t.Errorf("expected a single refetch once the interval has passed, got %v fetches", n)
+	}
+}
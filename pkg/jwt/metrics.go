@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics are Prometheus metrics for token validation and key sets.
+// A nil *Metrics records nothing
+type Metrics struct {
+	validations        *prometheus.CounterVec
+	validationDuration *prometheus.HistogramVec
+	keyFetches         *prometheus.CounterVec
+	keysDesc           *prometheus.Desc
+	keysExpiryDesc     *prometheus.Desc
+
+	mu      sync.Mutex
+	keySets map[string]*remoteKeySet
+}
+
+// NewMetrics creates the metrics and registers them with reg, e.g. prometheus.DefaultRegisterer.
+// Pass the result to WithMetrics and WithKeysMetrics
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		validations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jwt_validations_total",
+			Help: "Token validations by token type and result, which is valid or the error category",
+		}, []string{"token_type", "result"}),
+		validationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "jwt_validation_duration_seconds",
+			Help:    "Time taken to validate a token, including fetching keys and checking revocation",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"token_type"}),
+		keyFetches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "jwt_key_fetches_total",
+			Help: "Fetches of signing keys by key set and status",
+		}, []string{"key_set", "status"}),
+		keysDesc: prometheus.NewDesc("jwt_keys_cached",
+			"Number of cached signing keys", []string{"key_set"}, nil),
+		keysExpiryDesc: prometheus.NewDesc("jwt_keys_expiry_seconds",
+			"Seconds until the cached signing keys expire, negative once expired", []string{"key_set"}, nil),
+		keySets: make(map[string]*remoteKeySet),
+	}
+	collectors := []prometheus.Collector{m.validations, m.validationDuration, m.keyFetches, keySetCollector{m}}
+	for _, c := range collectors {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WithMetrics records validation results and latency in m.
+// Default key retreivers also record their fetches, as key sets "id_token" and "session_cookie"
+func WithMetrics(m *Metrics) ValidatorOption {
+	return func(v *Validator) {
+		v.metrics = m
+	}
+}
+
+// WithKeysMetrics records fetches and the state of the cached keys in m, labelled with name
+func WithKeysMetrics(m *Metrics, name string) KeyRetreiverOption {
+	return func(ks *remoteKeySet) {
+		ks.metrics = m
+		ks.metricsName = name
+		if m != nil {
+			m.mu.Lock()
+			m.keySets[name] = ks
+			m.mu.Unlock()
+		}
+	}
+}
+
+func (m *Metrics) observeValidation(tokenType string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	m.validations.WithLabelValues(tokenType, errorCategory(err)).Inc()
+	m.validationDuration.WithLabelValues(tokenType).Observe(time.Since(start).Seconds())
+}
+
+func (m *Metrics) observeKeyFetch(keySet string, err error) {
+	if m == nil {
+		return
+	}
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	m.keyFetches.WithLabelValues(keySet, status).Inc()
+}
+
+// errorCategories are the result labels of the error categories
+var errorCategories = []struct {
+	err   error
+	label string
+}{
+	{ErrMalformed, "malformed"},
+	{ErrSignatureInvalid, "signature_invalid"},
+	{ErrUnknownKeyID, "unknown_key_id"},
+	{ErrExpired, "expired"},
+	{ErrNotYetValid, "not_yet_valid"},
+	{ErrAudienceMismatch, "audience_mismatch"},
+	{ErrIssuerMismatch, "issuer_mismatch"},
+	{ErrEmailNotVerified, "email_not_verified"},
+	{ErrSignInProviderNotAllowed, "sign_in_provider_not_allowed"},
+	{ErrAuthTooOld, "auth_too_old"},
+	{ErrRequiredClaim, "required_claim"},
+	{ErrTokenRevoked, "revoked"},
+	{ErrUserDisabled, "user_disabled"},
+	{ErrKeysUnavailable, "keys_unavailable"},
+	{ErrRevocationUnavailable, "revocation_unavailable"},
+}
+
+func errorCategory(err error) string {
+	if err == nil {
+		return "valid"
+	}
+	for _, c := range errorCategories {
+		if errors.Is(err, c.err) {
+			return c.label
+		}
+	}
+	return "other"
+}
+
+// keySetCollector reports the state of the key sets registered with WithKeysMetrics when scraped
+type keySetCollector struct {
+	m *Metrics
+}
+
+func (c keySetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.m.keysDesc
+	ch <- c.m.keysExpiryDesc
+}
+
+func (c keySetCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	for name, ks := range c.m.keySets {
+		stats := ks.Stats()
+		ch <- prometheus.MustNewConstMetric(c.m.keysDesc, prometheus.GaugeValue, float64(stats.Keys), name)
+		expiry := 0.0
+		if !stats.ExpiresAt.IsZero() {
+			expiry = stats.ExpiresAt.Sub(ks.now()).Seconds()
+		}
+		ch <- prometheus.MustNewConstMetric(c.m.keysExpiryDesc, prometheus.GaugeValue, expiry, name)
+	}
+}
@@ -0,0 +1,51 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsValidationResults(t *testing.T) {
+	s := jwttest.NewServer(t)
+	reg := prometheus.NewPedanticRegistry()
+	metrics, err := jwt.NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := s.Validator(jwt.WithMetrics(metrics))
+
+	tokens := []struct {
+		token   string
+		wantErr error
+	}{
+		{s.Mint("user", nil), nil},
+		{s.Mint("user", nil, jwttest.WithIssuedAt(time.Now().Add(-2*time.Hour))), jwt.ErrExpired},
+		// the signature is valid, but role cannot be decoded into AuthToken
+		{s.Mint("user", map[string]any{"role": 1}), jwt.ErrMalformed},
+	}
+	for _, tt := range tokens {
+		_, err := v.Validate(context.Background(), jwt.ValidateTokenRequest{Token: tt.token, Audience: s.ProjectID})
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("expected %v, got %v", tt.wantErr, err)
+		}
+	}
+
+	want := `
+# HELP jwt_validations_total Token validations by token type and result, which is valid or the error category
+# TYPE jwt_validations_total counter
+jwt_validations_total{result="expired",token_type="id_token"} 1
+jwt_validations_total{result="malformed",token_type="id_token"} 1
+jwt_validations_total{result="valid",token_type="id_token"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "jwt_validations_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,118 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrNoToken is passed to the error handler when the request carries no token
+var ErrNoToken = errors.New("no token")
+
+// ErrForbidden is passed to the error handler, wrapping the reason, when a valid token fails MiddlewareOptions.Authorize
+var ErrForbidden = errors.New("forbidden")
+
+type MiddlewareOptions struct {
+	// Request is the template for every validation, e.g. the audience and policies. Its Token is taken from the http request
+	Request ValidateTokenRequest
+	// CookieName is a cookie holding an ID token, used when there is no Authorization header
+	CookieName string
+	// SessionCookieName is a cookie holding a Firebase session cookie, used when there is no Authorization header
+	SessionCookieName string
+	// QueryParam is a query parameter holding an ID token, used when there is neither an Authorization header nor a cookie
+	QueryParam string
+	// Authorize is called with every valid token, and the request is rejected if it returns an error, e.g. an authz.Requirement
+	Authorize func(token AuthToken) error
+	// ErrorHandler writes the response when validation fails. Defaults to DefaultErrorHandler
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type authTokenContextKey struct{}
+
+// NewContext returns a copy of ctx carrying the token
+func NewContext(ctx context.Context, token AuthToken) context.Context {
+	return context.WithValue(ctx, authTokenContextKey{}, token)
+}
+
+// FromContext returns the token stored by NewContext or Middleware
+func FromContext(ctx context.Context) (AuthToken, bool) {
+	token, ok := ctx.Value(authTokenContextKey{}).(AuthToken)
+	return token, ok
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header, or "" if there is none
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// Middleware validates the token of each request with v and stores the resulting AuthToken in the request context,
+// see FromContext. The token is read from the Authorization header, then the cookies and finally the query parameter
+func Middleware(v *Validator, opts MiddlewareOptions) func(http.Handler) http.Handler {
+	errorHandler := opts.ErrorHandler
+	if errorHandler == nil {
+		errorHandler = DefaultErrorHandler
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request := opts.Request
+			// the token only ever comes from the http request, never from the template
+			request.Token = ""
+			verify := v.Validate
+			if token := BearerToken(r); token != "" {
+				request.Token = token
+			} else if cookie, err := r.Cookie(opts.SessionCookieName); opts.SessionCookieName != "" && err == nil && cookie.Value != "" {
+				request.Token = cookie.Value
+				verify = v.VerifySessionCookie
+			} else if cookie, err := r.Cookie(opts.CookieName); opts.CookieName != "" && err == nil && cookie.Value != "" {
+				request.Token = cookie.Value
+			} else if opts.QueryParam != "" {
+				request.Token = r.URL.Query().Get(opts.QueryParam)
+			}
+			if request.Token == "" {
+				errorHandler(w, r, ErrNoToken)
+				return
+			}
+
+			token, err := verify(r.Context(), request)
+			if err != nil {
+				errorHandler(w, r, err)
+				return
+			}
+			if opts.Authorize != nil {
+				if err := opts.Authorize(token); err != nil {
+					if !errors.Is(err, ErrForbidden) {
+						err = fmt.Errorf("%w: %w", ErrForbidden, err)
+					}
+					errorHandler(w, r, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), token)))
+		})
+	}
+}
+
+// DefaultErrorHandler responds with 503 Service Unavailable if the token could not be checked,
+// 403 Forbidden with the reason if it was not authorized, and 401 Unauthorized otherwise
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrKeysUnavailable) || errors.Is(err, ErrRevocationUnavailable) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, ErrNoToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+	} else {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
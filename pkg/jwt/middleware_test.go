@@ -0,0 +1,140 @@
+package jwt_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/authz"
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestMiddleware(t *testing.T) {
+	s := jwttest.NewServer(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := jwt.FromContext(r.Context())
+		if !ok {
+			t.Error("token missing from context")
+		}
+		w.Write([]byte(token.UID))
+	})
+
+	tests := []struct {
+		name       string
+		authorize  func(jwt.AuthToken) error
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{"no token", nil, "", http.StatusUnauthorized, ""},
+		{"invalid token", nil, "garbage", http.StatusUnauthorized, ""},
+		{"valid token", nil, s.Mint("user", nil), http.StatusOK, "user"},
+		{"forbidden by requirement", authz.HasRole("admin"), s.Mint("user", nil), http.StatusForbidden, "forbidden: role \"\" is not one of [admin]\n"},
+		{"forbidden by plain error", func(jwt.AuthToken) error { return errors.New("nope") }, s.Mint("user", nil), http.StatusForbidden, "forbidden: nope\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := jwt.Middleware(s.Validator(), jwt.MiddlewareOptions{
+				Request:   jwt.ValidateTokenRequest{Audience: s.ProjectID},
+				Authorize: tt.authorize,
+			})(next)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %v, got %v: %v", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, w.Body.String())
+			}
+			if strings.Count(w.Body.String(), "forbidden") > 1 {
+				t.Errorf("forbidden repeated in %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareTokenSources(t *testing.T) {
+	s := jwttest.NewServer(t)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := jwt.FromContext(r.Context())
+		w.Write([]byte(token.UID))
+	})
+	opts := jwt.MiddlewareOptions{
+		Request:           jwt.ValidateTokenRequest{Audience: s.ProjectID},
+		CookieName:        "token",
+		SessionCookieName: "session",
+		QueryParam:        "token",
+	}
+	header := s.Mint("header", nil)
+	session := s.Mint("session", nil, jwttest.AsSessionCookie())
+	cookie := s.Mint("cookie", nil)
+	query := s.Mint("query", nil)
+
+	tests := []struct {
+		name       string
+		opts       func(jwt.MiddlewareOptions) jwt.MiddlewareOptions
+		header     string
+		session    string
+		cookie     string
+		query      string
+		wantStatus int
+		wantUID    string
+	}{
+		{name: "header", header: header, wantStatus: http.StatusOK, wantUID: "header"},
+		{name: "session cookie", session: session, wantStatus: http.StatusOK, wantUID: "session"},
+		{name: "cookie", cookie: cookie, wantStatus: http.StatusOK, wantUID: "cookie"},
+		{name: "query parameter", query: query, wantStatus: http.StatusOK, wantUID: "query"},
+		{name: "header before cookies and query", header: header, session: session, cookie: cookie, query: query, wantStatus: http.StatusOK, wantUID: "header"},
+		{name: "session cookie before cookie and query", session: session, cookie: cookie, query: query, wantStatus: http.StatusOK, wantUID: "session"},
+		{name: "cookie before query", cookie: cookie, query: query, wantStatus: http.StatusOK, wantUID: "cookie"},
+		// session cookies are verified as session cookies, so an ID token is rejected
+		{name: "ID token in session cookie", session: cookie, wantStatus: http.StatusUnauthorized},
+		{name: "session cookie in ID token cookie", cookie: session, wantStatus: http.StatusUnauthorized},
+		{name: "sources not configured", opts: func(o jwt.MiddlewareOptions) jwt.MiddlewareOptions {
+			o.CookieName, o.SessionCookieName, o.QueryParam = "", "", ""
+			return o
+		}, session: session, cookie: cookie, query: query, wantStatus: http.StatusUnauthorized},
+		{name: "token in the request template is ignored", opts: func(o jwt.MiddlewareOptions) jwt.MiddlewareOptions {
+			o.Request.Token = header
+			return o
+		}, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := opts
+			if tt.opts != nil {
+				o = tt.opts(o)
+			}
+			handler := jwt.Middleware(s.Validator(), o)(next)
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.header)
+			}
+			if tt.session != "" {
+				r.AddCookie(&http.Cookie{Name: "session", Value: tt.session})
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "token", Value: tt.cookie})
+			}
+			if tt.query != "" {
+				r.URL.RawQuery = url.Values{"token": {tt.query}}.Encode()
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %v, got %v: %v", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantUID != "" && w.Body.String() != tt.wantUID {
+				t.Errorf("expected the token of %v, got %v", tt.wantUID, w.Body.String())
+			}
+		})
+	}
+}
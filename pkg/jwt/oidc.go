@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OIDCConfiguration is the subset of an OpenID Provider's discovery document used for token validation
+type OIDCConfiguration struct {
+	Issuer                           string   `json:"issuer"`
+	JWKSURI                          string   `json:"jwks_uri"`
+	IDTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// DiscoverOIDC fetches the discovery document at <issuer>/.well-known/openid-configuration
+func DiscoverOIDC(ctx context.Context, client *http.Client, issuer string) (OIDCConfiguration, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return OIDCConfiguration{}, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return OIDCConfiguration{}, fmt.Errorf("error fetching openid configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return OIDCConfiguration{}, fmt.Errorf("got non success code from openid configuration: %v", resp.StatusCode)
+	}
+	config := OIDCConfiguration{}
+	err = json.NewDecoder(resp.Body).Decode(&config)
+	if err != nil {
+		return OIDCConfiguration{}, fmt.Errorf("error decoding openid configuration: %w", err)
+	}
+	// the issuer in the document must be identical to the one used to find it (OpenID Connect Discovery 1.0, section 4.3)
+	if config.Issuer != issuer {
+		return OIDCConfiguration{}, fmt.Errorf("openid configuration issuer %v does not match %v", config.Issuer, issuer)
+	}
+	if config.JWKSURI == "" {
+		return OIDCConfiguration{}, fmt.Errorf("openid configuration has no jwks_uri")
+	}
+	return config, nil
+}
+
+// NewOIDCValidator creates a Validator for ID tokens from any OpenID Connect issuer, e.g. "https://accounts.google.com"
+// for Google service account tokens. Keys are fetched from the discovered jwks_uri with the same caching as GoogleKeyRetreiver,
+// unless WithKeyRetreiver is given. Unless WithAllowedAlgorithms is given, the supported algorithms advertised by the issuer are accepted.
+// The audience of each request is checked as is, and auth_time is not required.
+// Session cookies are a Firebase concept, so VerifySessionCookie fails unless WithSessionCookieKeyRetreiver is given
+func NewOIDCValidator(ctx context.Context, issuer string, opts ...ValidatorOption) (*Validator, error) {
+	v := newValidator(opts...)
+	config, err := DiscoverOIDC(ctx, v.httpClient, issuer)
+	if err != nil {
+		return nil, err
+	}
+	v.issuerTemplate = config.Issuer
+	v.requireAuthTime = false
+	if len(v.algorithms) == 0 {
+		v.algorithms = supportedAlgorithms(config.IDTokenSigningAlgValuesSupported)
+	}
+	if v.keyRetreiver == nil {
+		v.keyRetreiver = NewJWKSKeyRetreiver(config.JWKSURI, WithKeysHTTPClient(v.httpClient), WithKeysClock(v.now), WithKeysMetrics(v.metrics, "oidc"))
+	}
+	v.setDefaults()
+	return v, nil
+}
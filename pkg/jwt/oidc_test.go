@@ -0,0 +1,90 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOIDCValidator(t *testing.T) {
+	s := jwttest.NewServer(t)
+	ctx := context.Background()
+	v, err := jwt.NewOIDCValidator(ctx, s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		claims        map[string]any
+		audience      string
+		wantAudiences []string
+		wantErr       error
+	}{
+		{"string audience", map[string]any{"iss": s.URL, "aud": "client"}, "client", []string{"client"}, nil},
+		// e.g. Keycloak issues tokens for the client and the account service
+		{"array audience", map[string]any{"iss": s.URL, "aud": []string{"account", "client"}}, "client", []string{"account", "client"}, nil},
+		{"other audience", map[string]any{"iss": s.URL, "aud": []string{"account"}}, "client", nil, jwt.ErrAudienceMismatch},
+		{"other issuer", map[string]any{"iss": "https://other.example.com", "aud": "client"}, "client", nil, jwt.ErrIssuerMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := v.Validate(ctx, jwt.ValidateTokenRequest{Token: s.Mint("user", tt.claims), Audience: tt.audience})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Audience != tt.audience || !reflect.DeepEqual(token.Audiences, tt.wantAudiences) {
+				t.Errorf("expected audience %v of %v, got %v of %v", tt.audience, tt.wantAudiences, token.Audience, token.Audiences)
+			}
+			if token.Issuer != s.URL || token.UID != "user" {
+				t.Errorf("unexpected issuer or uid: %+v", token)
+			}
+		})
+	}
+}
+
+func TestOIDCValidatorKeys(t *testing.T) {
+	s := jwttest.NewServer(t)
+	ctx := context.Background()
+	reg := prometheus.NewPedanticRegistry()
+	metrics, err := jwt.NewMetrics(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := jwt.NewOIDCValidator(ctx, s.URL, jwt.WithMetrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = v.Validate(ctx, jwt.ValidateTokenRequest{Token: s.Mint("user", map[string]any{"iss": s.URL, "aud": "client"}), Audience: "client"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+# HELP jwt_key_fetches_total Fetches of signing keys by key set and status
+# TYPE jwt_key_fetches_total counter
+jwt_key_fetches_total{key_set="oidc",status="success"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "jwt_key_fetches_total"); err != nil {
+		t.Error(err)
+	}
+
+	// OIDC issuers do not issue session cookies
+	_, err = v.VerifySessionCookie(ctx, jwt.ValidateTokenRequest{Token: s.Mint("user", nil, jwttest.AsSessionCookie()), Audience: "client"})
+	if err == nil || errors.Is(err, jwt.ErrValidation) {
+		t.Errorf("expected a configuration error, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package jwt
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// normalizeRequiredClaims checks that the required claims can be compared with the claims of a token,
+// before any token is looked at, so a misconfigured request fails the same way for every token
+func normalizeRequiredClaims(requiredClaims map[string]any) (map[string]any, error) {
+	normalized := make(map[string]any, len(requiredClaims))
+	for name, expected := range requiredClaims {
+		if expected == nil {
+			normalized[name] = nil
+			continue
+		}
+		expected, err := normalizeClaimValue(expected)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ValidateTokenRequest: required claim %v cannot be encoded as JSON: %w", name, err)
+		}
+		normalized[name] = expected
+	}
+	return normalized, nil
+}
+
+// checkPolicies enforces the policy fields of the request on the claims of an otherwise valid token.
+// requiredClaims are the RequiredClaims of the request, normalized by normalizeRequiredClaims
+func (v *Validator) checkPolicies(request ValidateTokenRequest, requiredClaims map[string]any, claims jwt.MapClaims, authTime float64) error {
+	if request.RequireEmailVerified {
+		emailVerified, _ := claims["email_verified"].(bool)
+		if !emailVerified {
+			return newValidationError(ErrEmailNotVerified, "", nil)
+		}
+	}
+	if len(request.AllowedSignInProviders) > 0 {
+		firebaseClaim, _ := claims["firebase"].(map[string]any)
+		provider, _ := firebaseClaim["sign_in_provider"].(string)
+		if !slices.Contains(request.AllowedSignInProviders, provider) {
+			return newValidationError(ErrSignInProviderNotAllowed, fmt.Sprintf("sign_in_provider=%q", provider), nil)
+		}
+	}
+	if request.MaxAuthAge > 0 {
+		authAge := v.now().Sub(time.Unix(int64(authTime), 0))
+		if authAge > request.MaxAuthAge+v.leeway {
+			return newValidationError(ErrAuthTooOld, fmt.Sprintf("authenticated %v ago, max %v", authAge.Truncate(time.Second), request.MaxAuthAge), nil)
+		}
+	}
+	for name, expected := range requiredClaims {
+		actual, ok := claims[name]
+		if !ok {
+			return newValidationError(ErrRequiredClaim, fmt.Sprintf("claim %v not found", name), nil)
+		}
+		if expected == nil {
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			return newValidationError(ErrRequiredClaim, fmt.Sprintf("claim %v has value %v, expected %v", name, actual, expected), nil)
+		}
+	}
+	return nil
+}
+
+// normalizeClaimValue round trips val through JSON, so that e.g. an int compares equal to the float64 decoded from the token
+func normalizeClaimValue(val any) (any, error) {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	var normalized any
+	err = json.Unmarshal(data, &normalized)
+	return normalized, err
+}
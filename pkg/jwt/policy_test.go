@@ -0,0 +1,82 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestValidatePolicies(t *testing.T) {
+	s := jwttest.NewServer(t)
+	now := time.Unix(1_700_000_000, 0)
+	v := s.Validator(jwt.WithClock(func() time.Time { return now }))
+	claims := map[string]any{
+		"email_verified": true,
+		"role":           "admin",
+		"seats":          4,
+		"firebase":       map[string]any{"sign_in_provider": "password"},
+		// issued recently, but signed in 10 minutes ago
+		"auth_time": now.Add(-10 * time.Minute).Unix(),
+	}
+
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		request jwt.ValidateTokenRequest
+		wantErr error
+	}{
+		{"email verified", claims, jwt.ValidateTokenRequest{RequireEmailVerified: true}, nil},
+		{"email not verified", map[string]any{"email_verified": false}, jwt.ValidateTokenRequest{RequireEmailVerified: true}, jwt.ErrEmailNotVerified},
+		{"email_verified missing", nil, jwt.ValidateTokenRequest{RequireEmailVerified: true}, jwt.ErrEmailNotVerified},
+		{"sign in provider allowed", claims, jwt.ValidateTokenRequest{AllowedSignInProviders: []string{"google.com", "password"}}, nil},
+		{"sign in provider not allowed", claims, jwt.ValidateTokenRequest{AllowedSignInProviders: []string{"google.com"}}, jwt.ErrSignInProviderNotAllowed},
+		{"auth within max age", claims, jwt.ValidateTokenRequest{MaxAuthAge: 11 * time.Minute}, nil},
+		{"auth too old", claims, jwt.ValidateTokenRequest{MaxAuthAge: 9 * time.Minute}, jwt.ErrAuthTooOld},
+		{"required claims present", claims, jwt.ValidateTokenRequest{RequiredClaims: map[string]any{"role": "admin", "seats": 4, "email_verified": nil}}, nil},
+		{"required claim missing", claims, jwt.ValidateTokenRequest{RequiredClaims: map[string]any{"tier": nil}}, jwt.ErrRequiredClaim},
+		{"required claim mismatched", claims, jwt.ValidateTokenRequest{RequiredClaims: map[string]any{"role": "viewer"}}, jwt.ErrRequiredClaim},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := tt.request
+			request.Token = s.Mint("user", tt.claims, jwttest.WithIssuedAt(now.Add(-time.Minute)))
+			request.Audience = s.ProjectID
+			_, err := v.Validate(context.Background(), request)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected token to be valid, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if !errors.Is(err, jwt.ErrValidation) {
+				t.Errorf("expected %v to match ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestValidateInvalidRequiredClaims(t *testing.T) {
+	s := jwttest.NewServer(t)
+	request := jwt.ValidateTokenRequest{
+		Audience:       s.ProjectID,
+		RequiredClaims: map[string]any{"role": func() {}},
+	}
+	// the request is rejected whatever the token, even one that would fail validation anyway
+	for _, token := range []string{s.Mint("user", nil), "garbage"} {
+		request.Token = token
+		_, err := s.Validator().Validate(context.Background(), request)
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if errors.Is(err, jwt.ErrValidation) {
+			t.Errorf("expected a configuration error, not a validation error: %v", err)
+		}
+	}
+}
@@ -2,61 +2,62 @@ package jwt
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
 )
 
+const googleKeysURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+const sessionCookieKeysURL = "https://www.googleapis.com/identitytoolkit/v3/relyingparty/publicKeys"
+
 type KeyRetreiver interface {
-	GetKeys(context.Context) (map[string]string, error)
+	// GetKeys returns the currently valid public keys, keyed by kid. The returned map is shared and must not be modified
+	GetKeys(context.Context) (map[string]crypto.PublicKey, error)
 }
 
+// GoogleKeyRetreiver retreives the x509 certificates Firebase uses to sign ID tokens
 type GoogleKeyRetreiver struct {
-	cache          map[string]string
-	cacheExpiresAt time.Time
-	sync.RWMutex
+	*remoteKeySet
 }
 
-func NewGoogleKeyRetreiver() KeyRetreiver {
+func NewGoogleKeyRetreiver(opts ...KeyRetreiverOption) *GoogleKeyRetreiver {
 	return &GoogleKeyRetreiver{
-		cache:          make(map[string]string),
-		cacheExpiresAt: time.Now(),
+		remoteKeySet: newRemoteKeySet(googleKeysURL, parseX509Keys, opts...),
 	}
 }
 
-func (kr *GoogleKeyRetreiver) GetKeys(ctx context.Context) (map[string]string, error) {
-	now := time.Now().UTC()
-	if len(kr.cache) > 0 && now.Before(kr.cacheExpiresAt) {
-		return kr.cache, nil
-	}
-	kr.Lock()
-	defer kr.Unlock()
-	resp, err := http.Get("https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com")
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("got non success code from google key: %v", resp.StatusCode)
+// NewSessionCookieKeyRetreiver retreives the x509 certificates Firebase uses to sign session cookies
+func NewSessionCookieKeyRetreiver(opts ...KeyRetreiverOption) *GoogleKeyRetreiver {
+	return &GoogleKeyRetreiver{
+		remoteKeySet: newRemoteKeySet(sessionCookieKeysURL, parseX509Keys, opts...),
 	}
-	defer resp.Body.Close()
-	result := make(map[string]string)
-	json.NewDecoder(resp.Body).Decode(&result)
-	maxAge, err := getMaxAge(resp)
+}
+
+// parseX509Keys parses a JSON object of kid to PEM encoded x509 certificate
+func parseX509Keys(body []byte) (map[string]crypto.PublicKey, error) {
+	certs := make(map[string]string)
+	err := json.Unmarshal(body, &certs)
 	if err != nil {
-		return nil, fmt.Errorf("error getting max age: %w", err)
+		return nil, fmt.Errorf("error decoding certificates: %w", err)
 	}
-	age, err := getAge(resp)
-	if err != nil {
-		return nil, fmt.Errorf("error getting age: %w", err)
+	keys := make(map[string]crypto.PublicKey, len(certs))
+	for kid, certPem := range certs {
+		block, _ := pem.Decode([]byte(certPem))
+		if block == nil {
+			return nil, fmt.Errorf("failed to decode certificate for kid %v", kid)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate for kid %v: %w", kid, err)
+		}
+		keys[kid] = cert.PublicKey
 	}
-	cacheExpiresAfterSeconds := maxAge - age
-	kr.cacheExpiresAt = time.Now().UTC().Add(time.Second * time.Duration(cacheExpiresAfterSeconds))
-	kr.cache = result
-	return kr.cache, nil
+	return keys, nil
 }
 
 func getMaxAge(resp *http.Response) (int, error) {
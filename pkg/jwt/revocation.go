@@ -0,0 +1,117 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/v4/auth"
+)
+
+// RevocationChecker is consulted after a token has been validated, to reject tokens
+// that were revoked or belong to a disabled user before they expire
+type RevocationChecker interface {
+	// CheckRevoked returns a ValidationError if tokens for uid issued at issuedAt are no longer accepted
+	CheckRevoked(ctx context.Context, uid string, issuedAt time.Time) error
+}
+
+// UserGetter looks up Firebase users. It is implemented by *auth.Client
+type UserGetter interface {
+	GetUser(ctx context.Context, uid string) (*auth.UserRecord, error)
+}
+
+// FirebaseRevocationChecker compares the token's iat with the user's TokensValidAfterMillis
+// and rejects tokens of disabled users. Users are cached for a TTL
+type FirebaseRevocationChecker struct {
+	users UserGetter
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu        sync.Mutex
+	cache     map[string]revocationEntry
+	lastSweep time.Time
+}
+
+type revocationEntry struct {
+	validAfter time.Time
+	disabled   bool
+	notFound   bool
+	fetchedAt  time.Time
+}
+
+type RevocationCheckerOption func(*FirebaseRevocationChecker)
+
+// WithRevocationClock sets the clock used to expire cached users. Defaults to time.Now
+func WithRevocationClock(now func() time.Time) RevocationCheckerOption {
+	return func(c *FirebaseRevocationChecker) {
+		c.now = now
+	}
+}
+
+func NewFirebaseRevocationChecker(users UserGetter, ttl time.Duration, opts ...RevocationCheckerOption) *FirebaseRevocationChecker {
+	c := &FirebaseRevocationChecker{
+		users: users,
+		ttl:   ttl,
+		now:   time.Now,
+		cache: make(map[string]revocationEntry),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.lastSweep = c.now()
+	return c
+}
+
+func (c *FirebaseRevocationChecker) CheckRevoked(ctx context.Context, uid string, issuedAt time.Time) error {
+	entry, err := c.lookup(ctx, uid)
+	if err != nil {
+		return err
+	}
+	if entry.notFound {
+		return newValidationError(ErrTokenRevoked, "user not found", nil)
+	}
+	if entry.disabled {
+		return newValidationError(ErrUserDisabled, "", nil)
+	}
+	if issuedAt.Before(entry.validAfter) {
+		return newValidationError(ErrTokenRevoked, fmt.Sprintf("issued at %v, tokens valid after %v", issuedAt.UTC(), entry.validAfter.UTC()), nil)
+	}
+	return nil
+}
+
+func (c *FirebaseRevocationChecker) lookup(ctx context.Context, uid string) (revocationEntry, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.cache[uid]
+	c.mu.Unlock()
+	if ok && now.Sub(entry.fetchedAt) < c.ttl {
+		return entry, nil
+	}
+
+	entry = revocationEntry{fetchedAt: now}
+	user, err := c.users.GetUser(ctx, uid)
+	if auth.IsUserNotFound(err) {
+		entry.notFound = true
+	} else if err != nil {
+		return revocationEntry{}, fmt.Errorf("%w: error getting user: %w", ErrRevocationUnavailable, err)
+	} else {
+		entry.disabled = user.Disabled
+		entry.validAfter = time.UnixMilli(user.TokensValidAfterMillis)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// drop expired entries so the cache does not grow with every user ever seen.
+	// Sweeping at most once per TTL keeps a miss from costing a pass over the whole cache
+	if now.Sub(c.lastSweep) >= c.ttl {
+		for cachedUid, cached := range c.cache {
+			if now.Sub(cached.fetchedAt) >= c.ttl {
+				delete(c.cache, cachedUid)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.cache[uid] = entry
+	return entry, nil
+}
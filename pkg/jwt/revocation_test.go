@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+)
+
+// userServer fakes the accounts:lookup endpoint of the Identity Toolkit API, which the auth client calls in emulator mode
+type userServer struct {
+	*httptest.Server
+	users   map[string]map[string]any
+	lookups atomic.Int64
+}
+
+func newUserGetter(t *testing.T, users map[string]map[string]any) (UserGetter, *userServer) {
+	t.Helper()
+	server := &userServer{users: users}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.lookups.Add(1)
+		request := struct {
+			LocalID []string `json:"localId"`
+		}{}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		found := []map[string]any{}
+		for _, uid := range request.LocalID {
+			if uid == "unavailable" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if user, ok := server.users[uid]; ok {
+				found = append(found, user)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"users": found})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("FIREBASE_AUTH_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+	app, err := firebase.NewApp(context.Background(), &firebase.Config{ProjectID: "proj"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := app.Auth(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestFirebaseRevocationChecker(t *testing.T) {
+	validAfter := time.Unix(1_700_000_000, 0)
+	users, _ := newUserGetter(t, map[string]map[string]any{
+		"active":   {"localId": "active", "validSince": "1700000000"},
+		"disabled": {"localId": "disabled", "disabled": true},
+	})
+	checker := NewFirebaseRevocationChecker(users, time.Minute)
+
+	tests := []struct {
+		name     string
+		uid      string
+		issuedAt time.Time
+		wantErr  error
+	}{
+		{"issued after tokens valid after", "active", validAfter.Add(time.Second), nil},
+		{"issued when tokens valid after", "active", validAfter, nil},
+		{"issued before tokens valid after", "active", validAfter.Add(-time.Second), ErrTokenRevoked},
+		{"disabled", "disabled", validAfter, ErrUserDisabled},
+		{"not found", "deleted", validAfter, ErrTokenRevoked},
+		{"lookup failed", "unavailable", validAfter, ErrRevocationUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checker.CheckRevoked(context.Background(), tt.uid, tt.issuedAt)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected the token to be accepted, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			// an unavailable check says nothing about the token
+			if errors.Is(err, ErrValidation) == (tt.wantErr == ErrRevocationUnavailable) {
+				t.Errorf("unexpected ErrValidation match for %v", err)
+			}
+		})
+	}
+}
+
+func TestFirebaseRevocationCheckerCache(t *testing.T) {
+	users, server := newUserGetter(t, map[string]map[string]any{
+		"a": {"localId": "a"},
+		"b": {"localId": "b"},
+	})
+	clock := &fakeClock{now: time.Now()}
+	checker := NewFirebaseRevocationChecker(users, time.Minute, WithRevocationClock(clock.Now))
+	check := func(uid string) {
+		t.Helper()
+		if err := checker.CheckRevoked(context.Background(), uid, clock.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check("a")
+	check("a")
+	if n := server.lookups.Load(); n != 1 {
+		t.Errorf("expected the user to be cached, got %v lookups", n)
+	}
+
+	// the user is looked up again once the TTL has passed
+	clock.Set(clock.Now().Add(time.Minute))
+	check("a")
+	if n := server.lookups.Load(); n != 2 {
+		t.Errorf("expected the user to be looked up again after the TTL, got %v lookups", n)
+	}
+
+	// expired entries are swept when a miss happens a TTL after the last sweep
+	clock.Set(clock.Now().Add(30 * time.Second))
+	check("b")
+	clock.Set(clock.Now().Add(61 * time.Second))
+	check("a")
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	if _, ok := checker.cache["b"]; ok {
+		t.Error("expected the expired entry for b to be swept")
+	}
+}
@@ -0,0 +1,45 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestSessionCookies(t *testing.T) {
+	s := jwttest.NewServer(t)
+	v := s.Validator()
+	cookie := s.Mint("user", nil, jwttest.AsSessionCookie())
+	idToken := s.Mint("user", nil)
+
+	tests := []struct {
+		name    string
+		verify  func(context.Context, jwt.ValidateTokenRequest) (jwt.AuthToken, error)
+		token   string
+		wantErr error
+	}{
+		{"session cookie is verified", v.VerifySessionCookie, cookie, nil},
+		{"ID token is not a session cookie", v.VerifySessionCookie, idToken, jwt.ErrIssuerMismatch},
+		{"session cookie is not an ID token", v.Validate, cookie, jwt.ErrIssuerMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := tt.verify(context.Background(), jwt.ValidateTokenRequest{Token: tt.token, Audience: s.ProjectID})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if token.UID != "user" || token.Issuer != "https://session.firebase.google.com/"+s.ProjectID {
+					t.Errorf("unexpected uid or issuer: %+v", token)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestValidateTrustedProjects(t *testing.T) {
+	s := jwttest.NewServer(t)
+	v := s.Validator()
+	trusted := []jwt.TrustedIssuer{{Audience: "project-a"}, {Audience: "project-b"}}
+	forProject := func(aud, issuerProject string) map[string]any {
+		return map[string]any{"aud": aud, "iss": "https://securetoken.google.com/" + issuerProject}
+	}
+
+	tests := []struct {
+		name          string
+		claims        map[string]any
+		wantProjectID string
+		wantErr       error
+	}{
+		{"first project", forProject("project-a", "project-a"), "project-a", nil},
+		{"second project", forProject("project-b", "project-b"), "project-b", nil},
+		{"untrusted project", forProject("project-c", "project-c"), "", jwt.ErrAudienceMismatch},
+		{"audience and issuer of different trusted projects", forProject("project-a", "project-b"), "", jwt.ErrIssuerMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := v.Validate(context.Background(), jwt.ValidateTokenRequest{Token: s.Mint("user", tt.claims), Trusted: trusted})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if token.ProjectID != tt.wantProjectID {
+					t.Errorf("expected project %v, got %v", tt.wantProjectID, token.ProjectID)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package jwt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/bjarke-xyz/auth/pkg/jwt")
+
+const firebaseIssuerTemplate = "https://securetoken.google.com/%s"
+const sessionCookieIssuerTemplate = "https://session.firebase.google.com/%s"
+
+type Validator struct {
+	keyRetreiver          KeyRetreiver
+	sessionKeyRetreiver   KeyRetreiver
+	httpClient            *http.Client
+	issuerTemplate        string
+	sessionIssuerTemplate string
+	algorithms            []string
+	now                   func() time.Time
+	leeway                time.Duration
+	revocationChecker     RevocationChecker
+	// requireAuthTime is set for Firebase tokens, which always carry auth_time
+	requireAuthTime bool
+	emulator        bool
+	metrics         *Metrics
+}
+
+type ValidatorOption func(*Validator)
+
+// WithKeyRetreiver sets the source of the public keys used to verify token signatures
+func WithKeyRetreiver(kr KeyRetreiver) ValidatorOption {
+	return func(v *Validator) {
+		v.keyRetreiver = kr
+	}
+}
+
+// WithSessionCookieKeyRetreiver sets the source of the public keys used to verify session cookie signatures
+func WithSessionCookieKeyRetreiver(kr KeyRetreiver) ValidatorOption {
+	return func(v *Validator) {
+		v.sessionKeyRetreiver = kr
+	}
+}
+
+// WithHTTPClient sets the http client used by the default key retreivers.
+// It has no effect on key retreivers set with WithKeyRetreiver or WithSessionCookieKeyRetreiver
+func WithHTTPClient(client *http.Client) ValidatorOption {
+	return func(v *Validator) {
+		v.httpClient = client
+	}
+}
+
+// WithIssuerTemplate sets the expected issuer. The template is formatted with the audience, e.g. "https://securetoken.google.com/%s".
+// A template without %s is used as is
+func WithIssuerTemplate(template string) ValidatorOption {
+	return func(v *Validator) {
+		v.issuerTemplate = template
+	}
+}
+
+// WithSessionCookieIssuerTemplate sets the expected issuer of session cookies, e.g. "https://session.firebase.google.com/%s"
+func WithSessionCookieIssuerTemplate(template string) ValidatorOption {
+	return func(v *Validator) {
+		v.sessionIssuerTemplate = template
+	}
+}
+
+// WithAllowedAlgorithms sets the accepted signing algorithms, see SupportedAlgorithms. Defaults to RS256.
+// It can be overridden per issuer with TrustedIssuer.Algorithms
+func WithAllowedAlgorithms(algorithms ...string) ValidatorOption {
+	return func(v *Validator) {
+		v.algorithms = algorithms
+	}
+}
+
+// WithClock sets the time source used when validating time based claims
+func WithClock(now func() time.Time) ValidatorOption {
+	return func(v *Validator) {
+		v.now = now
+	}
+}
+
+// WithLeeway sets the clock skew tolerated when validating exp, iat, nbf and auth_time. Defaults to 0
+func WithLeeway(leeway time.Duration) ValidatorOption {
+	return func(v *Validator) {
+		v.leeway = leeway
+	}
+}
+
+// WithRevocationChecker makes the validator reject revoked tokens, see FirebaseRevocationChecker
+func WithRevocationChecker(checker RevocationChecker) ValidatorOption {
+	return func(v *Validator) {
+		v.revocationChecker = checker
+	}
+}
+
+// WithEmulator makes the validator accept the unsigned tokens issued by the Firebase Auth emulator, and only those.
+// It must only be used when FIREBASE_AUTH_EMULATOR_HOST is set, never against real Firebase projects
+func WithEmulator() ValidatorOption {
+	return func(v *Validator) {
+		v.emulator = true
+	}
+}
+
+func NewValidator(opts ...ValidatorOption) *Validator {
+	v := newValidator(opts...)
+	if v.sessionKeyRetreiver == nil {
+		v.sessionKeyRetreiver = NewSessionCookieKeyRetreiver(WithKeysHTTPClient(v.httpClient), WithKeysClock(v.now), WithKeysMetrics(v.metrics, "session_cookie"))
+	}
+	v.setDefaults()
+	return v
+}
+
+func newValidator(opts ...ValidatorOption) *Validator {
+	v := &Validator{
+		httpClient:            http.DefaultClient,
+		issuerTemplate:        firebaseIssuerTemplate,
+		sessionIssuerTemplate: sessionCookieIssuerTemplate,
+		now:                   time.Now,
+		requireAuthTime:       true,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// setDefaults uses RS256 and Google's keys for the options that have not been set
+func (v *Validator) setDefaults() {
+	if len(v.algorithms) == 0 {
+		v.algorithms = []string{"RS256"}
+	}
+	if v.keyRetreiver == nil {
+		v.keyRetreiver = NewGoogleKeyRetreiver(WithKeysHTTPClient(v.httpClient), WithKeysClock(v.now), WithKeysMetrics(v.metrics, "id_token"))
+	}
+}
+
+// tokenKind is the key source and issuer of one kind of Firebase token
+type tokenKind struct {
+	name           string
+	keyRetreiver   KeyRetreiver
+	issuerTemplate string
+}
+
+func (k tokenKind) issuer(audience string) string {
+	if !strings.Contains(k.issuerTemplate, "%s") {
+		return k.issuerTemplate
+	}
+	return fmt.Sprintf(k.issuerTemplate, audience)
+}
+
+func (v *Validator) idToken() tokenKind {
+	return tokenKind{name: "id_token", keyRetreiver: v.keyRetreiver, issuerTemplate: v.issuerTemplate}
+}
+
+func (v *Validator) sessionCookie() tokenKind {
+	return tokenKind{name: "session_cookie", keyRetreiver: v.sessionKeyRetreiver, issuerTemplate: v.sessionIssuerTemplate}
+}
+
+// Validate validates a Firebase ID token
+func (v *Validator) Validate(ctx context.Context, request ValidateTokenRequest) (AuthToken, error) {
+	return ValidateInto[AuthToken](ctx, v, request)
+}
+
+// VerifySessionCookie validates a Firebase session cookie. request.Token is the cookie value
+func (v *Validator) VerifySessionCookie(ctx context.Context, request ValidateTokenRequest) (AuthToken, error) {
+	return VerifySessionCookieInto[AuthToken](ctx, v, request)
+}
+
+// verify validates the token and returns its JSON encoded claims and the audience it was issued for
+func (v *Validator) verify(ctx context.Context, request ValidateTokenRequest, kind tokenKind) ([]byte, string, error) {
+	if kind.keyRetreiver == nil && !v.emulator {
+		// only validators created by NewOIDCValidator have no session cookie keys
+		return nil, "", fmt.Errorf("validator has no %v keys, session cookies are only issued by Firebase", kind.name)
+	}
+	requiredClaims, err := normalizeRequiredClaims(request.RequiredClaims)
+	if err != nil {
+		return nil, "", err
+	}
+	trusted, err := v.selectTrustedIssuer(request, kind)
+	if err != nil {
+		return nil, "", err
+	}
+	keyFunc, algorithms, err := v.keyFunc(ctx, kind, trusted)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := jwt.Parse(request.Token, keyFunc,
+		jwt.WithValidMethods(algorithms),
+		jwt.WithAudience(trusted.Audience),
+		jwt.WithIssuer(trusted.Issuer),
+		jwt.WithTimeFunc(v.now),
+		jwt.WithLeeway(v.leeway),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, "", classifyParseError(err)
+	}
+	if !token.Valid {
+		return nil, "", newValidationError(ErrSignatureInvalid, "token not valid", nil)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, "", newValidationError(ErrMalformed, "failed to get token map claims", nil)
+	}
+	authTime := float64(0)
+	authTimeIface, ok := claims["auth_time"]
+	if !ok && v.requireAuthTime {
+		return nil, "", newValidationError(ErrMalformed, "claim auth_time not found", nil)
+	}
+	if ok {
+		authTime, ok = authTimeIface.(float64)
+		if !ok {
+			return nil, "", newValidationError(ErrMalformed, "claim auth_time has invalid type", nil)
+		}
+		// auth_time must be in the past
+		now := float64(v.now().UTC().Unix())
+		if authTime > now+v.leeway.Seconds() {
+			return nil, "", newValidationError(ErrNotYetValid, fmt.Sprintf("auth_time must be in the past. auth_time=%f now=%f", authTime, now), nil)
+		}
+	}
+	err = v.checkPolicies(request, requiredClaims, claims, authTime)
+	if err != nil {
+		return nil, "", err
+	}
+	if v.revocationChecker != nil {
+		subject, err := claims.GetSubject()
+		if err != nil {
+			return nil, "", newValidationError(ErrMalformed, "invalid sub claim", err)
+		}
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil || issuedAt == nil {
+			return nil, "", newValidationError(ErrMalformed, "invalid iat claim", err)
+		}
+		err = v.revocationChecker.CheckRevoked(ctx, subject, issuedAt.Time)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	payload, err := decodeClaimsSegment(token.Raw)
+	if err != nil {
+		return nil, "", newValidationError(ErrMalformed, "failed to decode claims", err)
+	}
+	return payload, trusted.Audience, nil
+}
+
+// keyFunc returns the function that looks up the key verifying a token, and the algorithms the token may be signed with
+func (v *Validator) keyFunc(ctx context.Context, kind tokenKind, trusted TrustedIssuer) (jwt.Keyfunc, []string, error) {
+	if v.emulator {
+		// the emulator issues tokens with alg none and no signature
+		return func(token *jwt.Token) (interface{}, error) {
+			return jwt.UnsafeAllowNoneSignatureType, nil
+		}, []string{jwt.SigningMethodNone.Alg()}, nil
+	}
+	keys, err := kind.keyRetreiver.GetKeys(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: error getting keys: %w", ErrKeysUnavailable, err)
+	}
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, ok := token.Header["kid"]
+		if !ok {
+			return nil, newValidationError(ErrMalformed, "kid not found in token header", nil)
+		}
+		kidStr, ok := kid.(string)
+		if !ok {
+			return nil, newValidationError(ErrMalformed, "kid was not a string", nil)
+		}
+		key, ok := keys[kidStr]
+		if refresher, canRefresh := kind.keyRetreiver.(KeyRefresher); !ok && canRefresh {
+			// the keys may have been rotated since they were cached
+			refreshedKeys, err := refresher.RefreshKeys(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("%w: error refreshing keys: %w", ErrKeysUnavailable, err)
+			}
+			key, ok = refreshedKeys[kidStr]
+		}
+		if !ok {
+			return nil, newValidationError(ErrUnknownKeyID, fmt.Sprintf("key not found for kid %v", kidStr), nil)
+		}
+		if !keyMatchesMethod(token.Method, key) {
+			return nil, newValidationError(ErrSignatureInvalid, fmt.Sprintf("key for kid %v cannot verify %v signatures", kidStr, token.Header["alg"]), nil)
+		}
+		return key, nil
+	}, trusted.Algorithms, nil
+}
+
+// ValidateInto validates the ID token with v and decodes its claims into T using JSON struct tags
+func ValidateInto[T any](ctx context.Context, v *Validator, request ValidateTokenRequest) (T, error) {
+	return validateInto[T](ctx, v, request, v.idToken())
+}
+
+// VerifySessionCookieInto validates the session cookie with v and decodes its claims into T using JSON struct tags
+func VerifySessionCookieInto[T any](ctx context.Context, v *Validator, request ValidateTokenRequest) (T, error) {
+	return validateInto[T](ctx, v, request, v.sessionCookie())
+}
+
+func validateInto[T any](ctx context.Context, v *Validator, request ValidateTokenRequest, kind tokenKind) (T, error) {
+	ctx, span := tracer.Start(ctx, "jwt.Validate", trace.WithAttributes(attribute.String("jwt.token_type", kind.name)))
+	defer span.End()
+	start := time.Now()
+	claims, err := verifyInto[T](ctx, v, request, kind)
+	// recorded after decoding, so claims that cannot be decoded into T count as malformed
+	v.metrics.observeValidation(kind.name, start, err)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, errorCategory(err))
+	}
+	return claims, err
+}
+
+func verifyInto[T any](ctx context.Context, v *Validator, request ValidateTokenRequest, kind tokenKind) (T, error) {
+	var claims T
+	payload, audience, err := v.verify(ctx, request, kind)
+	if err != nil {
+		return claims, err
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		var zero T
+		return zero, newValidationError(ErrMalformed, "failed to decode claims", err)
+	}
+	if authToken, ok := any(&claims).(*AuthToken); ok {
+		authToken.ProjectID = audience
+		authToken.Audience = audience
+		if authToken.UID == "" {
+			// only Firebase tokens carry user_id
+			authToken.UID = authToken.Subject
+		}
+	}
+	return claims, nil
+}
+
+// selectTrustedIssuer picks the trusted audience and issuer matching the unverified claims of the token.
+// If none match, the first is returned so that verification reports the mismatch
+func (v *Validator) selectTrustedIssuer(request ValidateTokenRequest, kind tokenKind) (TrustedIssuer, error) {
+	trusted := slices.Clone(request.Trusted)
+	if len(trusted) == 0 {
+		trusted = []TrustedIssuer{{Audience: request.Audience}}
+	}
+	for i := range trusted {
+		if trusted[i].Issuer == "" {
+			trusted[i].Issuer = kind.issuer(trusted[i].Audience)
+		}
+		if len(trusted[i].Algorithms) == 0 {
+			trusted[i].Algorithms = v.algorithms
+		}
+	}
+	if len(trusted) == 1 {
+		return trusted[0], nil
+	}
+	claims := jwt.MapClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(request.Token, claims)
+	if err != nil {
+		return TrustedIssuer{}, classifyParseError(err)
+	}
+	audiences, _ := claims.GetAudience()
+	issuer, _ := claims.GetIssuer()
+	for _, t := range trusted {
+		if t.Issuer == issuer && slices.Contains(audiences, t.Audience) {
+			return t, nil
+		}
+	}
+	return trusted[0], nil
+}
+
+func decodeClaimsSegment(raw string) ([]byte, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token contains an invalid number of segments")
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+}
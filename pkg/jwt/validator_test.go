@@ -0,0 +1,93 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bjarke-xyz/auth/pkg/jwt"
+	"github.com/bjarke-xyz/auth/pkg/jwt/jwttest"
+)
+
+func TestValidateTimeClaimsWithLeeway(t *testing.T) {
+	s := jwttest.NewServer(t)
+	now := time.Unix(1_700_000_000, 0)
+	leeway := 30 * time.Second
+	at := func(d time.Duration) int64 { return now.Add(d).Unix() }
+
+	tests := []struct {
+		name    string
+		leeway  time.Duration
+		claims  map[string]any
+		wantErr error
+	}{
+		{"exp within leeway", leeway, map[string]any{"exp": at(-29 * time.Second)}, nil},
+		{"exp beyond leeway", leeway, map[string]any{"exp": at(-31 * time.Second)}, jwt.ErrExpired},
+		{"exp passed without leeway", 0, map[string]any{"exp": at(-time.Second)}, jwt.ErrExpired},
+		{"nbf within leeway", leeway, map[string]any{"nbf": at(29 * time.Second)}, nil},
+		{"nbf beyond leeway", leeway, map[string]any{"nbf": at(31 * time.Second)}, jwt.ErrNotYetValid},
+		{"nbf in future without leeway", 0, map[string]any{"nbf": at(time.Second)}, jwt.ErrNotYetValid},
+		{"iat in future within leeway", leeway, map[string]any{"iat": at(29 * time.Second)}, nil},
+		{"iat in future beyond leeway", leeway, map[string]any{"iat": at(31 * time.Second)}, jwt.ErrNotYetValid},
+		{"iat in future without leeway", 0, map[string]any{"iat": at(time.Second)}, jwt.ErrNotYetValid},
+		{"auth_time in future within leeway", leeway, map[string]any{"auth_time": at(29 * time.Second)}, nil},
+		{"auth_time in future beyond leeway", leeway, map[string]any{"auth_time": at(31 * time.Second)}, jwt.ErrNotYetValid},
+		{"auth_time in future without leeway", 0, map[string]any{"auth_time": at(time.Second)}, jwt.ErrNotYetValid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := s.Validator(jwt.WithClock(func() time.Time { return now }), jwt.WithLeeway(tt.leeway))
+			token := s.Mint("user", tt.claims, jwttest.WithIssuedAt(now.Add(-time.Minute)))
+			_, err := v.Validate(context.Background(), jwt.ValidateTokenRequest{Token: token, Audience: s.ProjectID})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected token to be valid, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if !errors.Is(err, jwt.ErrValidation) {
+				t.Errorf("expected %v to match ErrValidation", err)
+			}
+		})
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	s := jwttest.NewServer(t)
+	other := jwttest.NewServer(t)
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(unavailable.Close)
+
+	tests := []struct {
+		name           string
+		validator      *jwt.Validator
+		token          string
+		wantErr        error
+		wantValidation bool
+	}{
+		{"unknown key id", s.Validator(), s.Mint("user", nil, jwttest.WithKeyID("unknown")), jwt.ErrUnknownKeyID, true},
+		{"keys unavailable", jwt.NewValidator(jwt.WithKeyRetreiver(jwt.NewGoogleKeyRetreiver(jwt.WithKeysURL(unavailable.URL)))), s.Mint("user", nil), jwt.ErrKeysUnavailable, false},
+		// other signs with its own key under the same kid
+		{"signed by another key", s.Validator(), other.Mint("user", nil), jwt.ErrSignatureInvalid, true},
+		{"garbage", s.Validator(), "garbage", jwt.ErrMalformed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.validator.Validate(context.Background(), jwt.ValidateTokenRequest{Token: tt.token, Audience: s.ProjectID})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if errors.Is(err, jwt.ErrValidation) != tt.wantValidation {
+				t.Errorf("expected %v to match ErrValidation: %v", err, tt.wantValidation)
+			}
+		})
+	}
+}